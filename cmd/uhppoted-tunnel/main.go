@@ -13,6 +13,7 @@ import (
 var cli = []lib.Command{
 	&commands.DAEMONIZE,
 	&commands.UNDAEMONIZE,
+	&commands.CERT,
 	&version,
 }
 
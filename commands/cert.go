@@ -0,0 +1,349 @@
+package commands
+
+import (
+	"crypto"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/pki"
+)
+
+var CERT = Cert{
+	caCertificate: "ca.cert",
+	caKey:         "ca.key",
+	organization:  SERVICE,
+}
+
+// Cert implements the 'cert' command to create a CA and issue, renew and list the TLS
+// certificates used by the TLS and HTTPS connectors.
+type Cert struct {
+	subcommand    string
+	caCertificate string
+	caKey         string
+	certificate   string
+	key           string
+	name          string
+	organization  string
+	sans          string
+	days          int
+	overwrite     bool
+	files         []string
+}
+
+const CA_VALIDITY = 3650
+const CERTIFICATE_VALIDITY = 825
+
+var subcommands = map[string]string{
+	"ca":     "Creates a self-signed CA certificate and key",
+	"server": "Issues a server certificate and key signed by the CA",
+	"client": "Issues a client certificate and key signed by the CA",
+	"renew":  "Reissues an existing certificate with a new validity period (keeping the existing key)",
+	"list":   "Lists the subject, SANs, validity and public key pin of certificate files",
+}
+
+func (cmd *Cert) Name() string {
+	return "cert"
+}
+
+func (cmd *Cert) FlagSet() *flag.FlagSet {
+	flagset := flag.NewFlagSet("cert", flag.ExitOnError)
+
+	flagset.StringVar(&cmd.caCertificate, "ca-cert", cmd.caCertificate, "File path for the CA certificate PEM file")
+	flagset.StringVar(&cmd.caKey, "ca-key", cmd.caKey, "File path for the CA key PEM file")
+	flagset.StringVar(&cmd.certificate, "cert", cmd.certificate, "File path for the issued certificate PEM file (defaults to server.cert or client.cert)")
+	flagset.StringVar(&cmd.key, "key", cmd.key, "File path for the issued key PEM file (defaults to server.key or client.key)")
+	flagset.StringVar(&cmd.name, "name", cmd.name, "Certificate subject common name")
+	flagset.StringVar(&cmd.organization, "org", cmd.organization, "Certificate subject organization")
+	flagset.StringVar(&cmd.sans, "san", cmd.sans, "Comma separated list of subject alternative names (DNS names, IP addresses, URIs and email addresses)")
+	flagset.IntVar(&cmd.days, "days", cmd.days, "Certificate validity in days (defaults to 3650 for a CA and 825 otherwise)")
+	flagset.BoolVar(&cmd.overwrite, "overwrite", cmd.overwrite, "Replaces existing certificate and key files")
+
+	return flagset
+}
+
+func (cmd *Cert) Description() string {
+	return "Creates a CA and issues, renews and lists TLS client and server certificates"
+}
+
+func (cmd *Cert) Usage() string {
+	return "cert ca|server|client|renew|list [options]"
+}
+
+func (cmd *Cert) Help() {
+	fmt.Println()
+	fmt.Printf("  Usage: %s cert <command> [options]\n", SERVICE)
+	fmt.Println()
+	fmt.Println("    Creates a CA and issues, renews and lists the TLS certificates used by the TLS and HTTPS connectors")
+	fmt.Println()
+	fmt.Println("  Commands:")
+	for _, k := range []string{"ca", "server", "client", "renew", "list"} {
+		fmt.Printf("    %-8s %s\n", k, subcommands[k])
+	}
+	fmt.Println()
+	fmt.Println("  Options:")
+
+	helpOptions(cmd.FlagSet())
+
+	fmt.Println("  Examples:")
+	fmt.Println()
+	fmt.Printf("    %s cert ca     --name \"uhppoted-tunnel CA\"\n", SERVICE)
+	fmt.Printf("    %s cert server --name tunnel.example.com --san 192.168.1.100,tunnel.local\n", SERVICE)
+	fmt.Printf("    %s cert client --name workshop --san spiffe://uhppoted/site/workshop\n", SERVICE)
+	fmt.Printf("    %s cert renew  --cert server.cert --key server.key --days 365\n", SERVICE)
+	fmt.Printf("    %s cert list   ca.cert server.cert client.cert\n", SERVICE)
+	fmt.Println()
+}
+
+func (cmd *Cert) ParseCmd(args ...string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing cert command (ca, server, client, renew or list)")
+	}
+
+	if _, ok := subcommands[args[0]]; !ok {
+		return fmt.Errorf("invalid cert command '%v'", args[0])
+	}
+
+	cmd.subcommand = args[0]
+
+	flagset := cmd.FlagSet()
+	if err := flagset.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cmd.files = flagset.Args()
+
+	return nil
+}
+
+func (cmd *Cert) Execute(args ...any) error {
+	switch cmd.subcommand {
+	case "ca":
+		return cmd.ca()
+
+	case "server":
+		return cmd.issue("server", pki.IssueServer)
+
+	case "client":
+		return cmd.issue("client", pki.IssueClient)
+
+	case "renew":
+		return cmd.renew()
+
+	case "list":
+		return cmd.list()
+
+	default:
+		return fmt.Errorf("invalid cert command '%v'", cmd.subcommand)
+	}
+}
+
+func (cmd *Cert) ca() error {
+	name := cmd.name
+	if name == "" {
+		name = fmt.Sprintf("%v CA", SERVICE)
+	}
+
+	subject, err := pki.NewSubject(name, cmd.organization, cmd.sans)
+	if err != nil {
+		return err
+	}
+
+	certificate, key, err := pki.NewCA(*subject, cmd.validity(CA_VALIDITY))
+	if err != nil {
+		return err
+	}
+
+	if err := pki.WriteKeypair(cmd.caCertificate, certificate, cmd.caKey, key, cmd.overwrite); err != nil {
+		return err
+	}
+
+	fmt.Printf("   ... created CA certificate %v and key %v\n", cmd.caCertificate, cmd.caKey)
+	describe(cmd.caCertificate, certificate)
+
+	return nil
+}
+
+func (cmd *Cert) issue(kind string, f func(pki.Subject, time.Duration, *x509.Certificate, crypto.Signer) (*x509.Certificate, crypto.Signer, error)) error {
+	certfile := cmd.certificate
+	keyfile := cmd.key
+
+	if certfile == "" {
+		certfile = kind + ".cert"
+	}
+
+	if keyfile == "" {
+		keyfile = kind + ".key"
+	}
+
+	ca, cakey, err := cmd.issuer()
+	if err != nil {
+		return err
+	}
+
+	subject, err := pki.NewSubject(cmd.name, cmd.organization, cmd.sans)
+	if err != nil {
+		return fmt.Errorf("%v (use --name)", err)
+	}
+
+	certificate, key, err := f(*subject, cmd.validity(CERTIFICATE_VALIDITY), ca, cakey)
+	if err != nil {
+		return err
+	}
+
+	if err := pki.WriteKeypair(certfile, certificate, keyfile, key, cmd.overwrite); err != nil {
+		return err
+	}
+
+	fmt.Printf("   ... issued %v certificate %v and key %v\n", kind, certfile, keyfile)
+	describe(certfile, certificate)
+
+	return nil
+}
+
+func (cmd *Cert) renew() error {
+	if cmd.certificate == "" || cmd.key == "" {
+		return fmt.Errorf("renew requires the --cert and --key of the certificate to be renewed")
+	}
+
+	certificates, err := pki.Certificates(cmd.certificate)
+	if err != nil {
+		return err
+	} else if len(certificates) == 0 {
+		return fmt.Errorf("no certificate in %v", cmd.certificate)
+	}
+
+	key, err := pki.LoadKey(cmd.key)
+	if err != nil {
+		return err
+	}
+
+	original := certificates[0]
+	days := CERTIFICATE_VALIDITY
+	if original.IsCA {
+		days = CA_VALIDITY
+	}
+
+	var ca *x509.Certificate
+	var cakey crypto.Signer
+	if !original.IsCA {
+		if ca, cakey, err = cmd.issuer(); err != nil {
+			return err
+		}
+	}
+
+	certificate, err := pki.Renew(original, key, cmd.validity(days), ca, cakey)
+	if err != nil {
+		return err
+	}
+
+	if err := pki.WriteCertificate(cmd.certificate, certificate, true); err != nil {
+		return err
+	}
+
+	fmt.Printf("   ... renewed certificate %v\n", cmd.certificate)
+	describe(cmd.certificate, certificate)
+
+	return nil
+}
+
+func (cmd *Cert) list() error {
+	files := cmd.files
+	if len(files) == 0 {
+		for _, f := range []string{cmd.caCertificate, "server.cert", "client.cert"} {
+			if _, err := os.Stat(f); err == nil {
+				files = append(files, f)
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("no certificate files")
+	}
+
+	for _, file := range files {
+		if certificates, err := pki.Certificates(file); err != nil {
+			return err
+		} else {
+			for _, certificate := range certificates {
+				describe(file, certificate)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (cmd *Cert) issuer() (*x509.Certificate, crypto.Signer, error) {
+	certificates, err := pki.Certificates(cmd.caCertificate)
+	if err != nil {
+		return nil, nil, err
+	} else if len(certificates) == 0 {
+		return nil, nil, fmt.Errorf("no CA certificate in %v", cmd.caCertificate)
+	}
+
+	key, err := pki.LoadKey(cmd.caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certificates[0], key, nil
+}
+
+func (cmd *Cert) validity(days int) time.Duration {
+	if cmd.days > 0 {
+		days = cmd.days
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func describe(file string, certificate *x509.Certificate) {
+	sans := []string{}
+	sans = append(sans, certificate.DNSNames...)
+	for _, ip := range certificate.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range certificate.URIs {
+		sans = append(sans, uri.String())
+	}
+	sans = append(sans, certificate.EmailAddresses...)
+
+	usage := []string{}
+	if certificate.IsCA {
+		usage = append(usage, "CA")
+	}
+	for _, u := range certificate.ExtKeyUsage {
+		switch u {
+		case x509.ExtKeyUsageServerAuth:
+			usage = append(usage, "server")
+		case x509.ExtKeyUsageClientAuth:
+			usage = append(usage, "client")
+		}
+	}
+
+	status := "valid"
+	if now := time.Now(); now.After(certificate.NotAfter) {
+		status = "EXPIRED"
+	} else if now.Before(certificate.NotBefore) {
+		status = "NOT YET VALID"
+	} else if certificate.NotAfter.Sub(now) < 30*24*time.Hour {
+		status = fmt.Sprintf("expires in %v days", int(certificate.NotAfter.Sub(now).Hours()/24))
+	}
+
+	fmt.Println()
+	fmt.Printf("  %v\n", file)
+	fmt.Printf("    subject    %v\n", certificate.Subject)
+	fmt.Printf("    issuer     %v\n", certificate.Issuer)
+	fmt.Printf("    serial     %x\n", certificate.SerialNumber)
+	fmt.Printf("    usage      %v\n", strings.Join(usage, ", "))
+	if len(sans) > 0 {
+		fmt.Printf("    SANs       %v\n", strings.Join(sans, ", "))
+	}
+	fmt.Printf("    valid      %v to %v (%v)\n", certificate.NotBefore.Format(time.DateOnly), certificate.NotAfter.Format(time.DateOnly), status)
+	fmt.Printf("    pin        %v\n", pki.Pin(certificate))
+	fmt.Println()
+}
@@ -23,13 +23,21 @@ import (
 
 	"github.com/uhppoted/uhppoted-tunnel/log"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/acl"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/auth"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/cache"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/http"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/ip"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/nat"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/pki"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/psk"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/tailscale"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/tcp"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/timesync"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/tls"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/udp"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/validate"
 )
 
 type Run struct {
@@ -50,21 +58,69 @@ type Run struct {
 	certificate       string
 	key               string
 	requireClientAuth bool
-	auth              string
-	html              string
-	lockfile          config.Lockfile
-	logFile           string
-	logFileSize       int
-	logLevel          string
-	workdir           string
-	debug             bool
-	console           bool
-	daemon            bool
+	crl               string
+	ocsp              bool
+	acl               string
+	psk               string
+	httpAuth          string
+	httpClient        struct {
+		token string
+		proxy string
+	}
+	httpPolicy struct {
+		origins string
+		methods string
+		csrf    bool
+		csp     string
+	}
+	httpServer struct {
+		readTimeout   time.Duration
+		writeTimeout  time.Duration
+		idleTimeout   time.Duration
+		headerTimeout time.Duration
+		maxStreams    uint
+	}
+	acme struct {
+		hosts     string
+		directory string
+		email     string
+		challenge string
+		ca        string
+	}
+	tlsOptions struct {
+		minVersion string
+		maxVersion string
+		ciphers    string
+		curves     string
+		alpn       string
+		serverName string
+		pins       string
+	}
+	auth        string
+	html        string
+	lockfile    config.Lockfile
+	logFile     string
+	logFileSize int
+	logLevel    string
+	workdir     string
+	debug       bool
+	debugFormat string
+	console     bool
+	daemon      bool
 
 	rateLimit  rate.Limit
 	burstLimit int
 
-	controllers map[uint32]string
+	controllers map[uint32]conn.Controller
+	nat         map[string]string
+	serials     map[uint32]uint32
+	ipPersist   bool
+	udpRetries  int
+
+	discoveryCache time.Duration
+	responseCache  string
+	validate       string
+	timeSync       time.Duration
 }
 
 const MAX_RETRIES = -1
@@ -92,17 +148,53 @@ func (cmd *Run) flags() *flag.FlagSet {
 	flagset.IntVar(&cmd.maxRetries, "max-retries", cmd.maxRetries, "Maximum number of times to retry failed connection. Defaults to -1 (retry forever)")
 	flagset.DurationVar(&cmd.maxRetryDelay, "max-retry-delay", cmd.maxRetryDelay, "Maximum delay between retrying failed connections")
 	flagset.DurationVar(&cmd.udpTimeout, "udp-timeout", cmd.udpTimeout, "Time limit to wait for UDP replies")
+	flagset.IntVar(&cmd.udpRetries, "udp-retries", cmd.udpRetries, "(UDP broadcast and IP/out only) Number of times to resend idempotent (get) requests that have not received a reply within the UDP timeout")
 
 	flagset.StringVar(&cmd.caCertificate, "ca-cert", cmd.caCertificate, "File path for CA certificate PEM file (defaults to ca.cert)")
 	flagset.StringVar(&cmd.certificate, "cert", cmd.certificate, "File path for client/server TLS certificate PEM file (defaults to client.cert or server.cert)")
 	flagset.StringVar(&cmd.key, "key", cmd.key, "File path for client/server TLS key PEM file (defaults to client.key or server.key)")
 	flagset.BoolVar(&cmd.requireClientAuth, "client-auth", cmd.requireClientAuth, "Requires client authentication for TLS")
-
-	flagset.StringVar(&cmd.html, "html", cmd.html, "HTML folder for HTTP/HTTPS connectors")
+	flagset.StringVar(&cmd.crl, "crl", cmd.crl, "(optional) File path for a certificate revocation list (PEM or DER) used to reject revoked TLS peers")
+	flagset.BoolVar(&cmd.ocsp, "ocsp", cmd.ocsp, "Enables OCSP revocation checking of TLS peer certificates and OCSP stapling for TLS servers")
+	flagset.StringVar(&cmd.tlsOptions.minVersion, "tls-min-version", cmd.tlsOptions.minVersion, "(TLS only) Minimum TLS version (1.2 or 1.3). Defaults to 1.2")
+	flagset.StringVar(&cmd.tlsOptions.maxVersion, "tls-max-version", cmd.tlsOptions.maxVersion, "(TLS only) Maximum TLS version (1.2 or 1.3). Defaults to 1.3")
+	flagset.StringVar(&cmd.tlsOptions.ciphers, "tls-ciphers", cmd.tlsOptions.ciphers, "(TLS only) Comma separated list of TLS 1.2 cipher suites e.g. TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	flagset.StringVar(&cmd.tlsOptions.curves, "tls-curves", cmd.tlsOptions.curves, "(TLS only) Comma separated list of preferred elliptic curves (X25519, P256, P384, P521)")
+	flagset.StringVar(&cmd.tlsOptions.alpn, "tls-alpn", cmd.tlsOptions.alpn, "(TLS only) Comma separated list of ALPN protocols")
+	flagset.StringVar(&cmd.tlsOptions.serverName, "tls-server-name", cmd.tlsOptions.serverName, "(TLS client only) Server name for SNI and server certificate verification (defaults to the host address)")
+	flagset.StringVar(&cmd.tlsOptions.pins, "tls-pin", cmd.tlsOptions.pins, "(TLS only) Comma separated list of pinned peer public key SHA-256 hashes (sha256/<base64> or hex)")
+	flagset.StringVar(&cmd.psk, "psk", cmd.psk, "(TCP only) Pre-shared key for mutual authentication and encryption of TCP tunnels (file:<path> or env:<variable>)")
+	flagset.StringVar(&cmd.acl, "acl", cmd.acl, "(optional) TOML file that maps client certificate identities to permitted controllers and functions (TLS server and HTTPS IN connectors only)")
+
+	flagset.StringVar(&cmd.acme.hosts, "acme", cmd.acme.hosts, "(HTTPS only) Comma separated list of host names for which to obtain the server certificate automatically from an ACME CA")
+	flagset.StringVar(&cmd.acme.directory, "acme-directory", cmd.acme.directory, "(HTTPS only) ACME directory URL (defaults to Let's Encrypt)")
+	flagset.StringVar(&cmd.acme.email, "acme-email", cmd.acme.email, "(HTTPS only) (optional) Contact email address for the ACME account")
+	flagset.StringVar(&cmd.acme.challenge, "acme-http", cmd.acme.challenge, "(HTTPS only) (optional) Bind address for the ACME HTTP-01 challenge listener e.g. 0.0.0.0:80")
+	flagset.StringVar(&cmd.acme.ca, "acme-ca", cmd.acme.ca, "(HTTPS only) (optional) CA certificate PEM file for a private ACME directory server")
+
+	flagset.StringVar(&cmd.httpAuth, "http-auth", cmd.httpAuth, "(HTTP only) (optional) TOML file with the users, bearer tokens and JWKS used to authenticate HTTP/HTTPS requests")
+	flagset.StringVar(&cmd.httpPolicy.origins, "cors-origins", cmd.httpPolicy.origins, "(HTTP only) (optional) Comma separated list of origins permitted to make cross-origin requests e.g. https://portal.example.com")
+	flagset.StringVar(&cmd.httpPolicy.methods, "cors-methods", cmd.httpPolicy.methods, "(HTTP only) (optional) Comma separated list of methods permitted for cross-origin requests (defaults to GET, POST, PUT, DELETE)")
+	flagset.BoolVar(&cmd.httpPolicy.csrf, "csrf", cmd.httpPolicy.csrf, "(HTTP only) Enables CSRF protection for requests that are not authenticated with a bearer token")
+	flagset.StringVar(&cmd.httpPolicy.csp, "csp", cmd.httpPolicy.csp, "(HTTP only) (optional) Content-Security-Policy header for HTTP responses")
+	flagset.DurationVar(&cmd.httpServer.readTimeout, "http-read-timeout", cmd.httpServer.readTimeout, "(HTTP only) (optional) Maximum time to read a request, including the body (defaults to 30s)")
+	flagset.DurationVar(&cmd.httpServer.writeTimeout, "http-write-timeout", cmd.httpServer.writeTimeout, "(HTTP only) (optional) Maximum time to write a response (defaults to 60s)")
+	flagset.DurationVar(&cmd.httpServer.idleTimeout, "http-idle-timeout", cmd.httpServer.idleTimeout, "(HTTP only) (optional) Maximum time to keep an idle connection open (defaults to 120s)")
+	flagset.DurationVar(&cmd.httpServer.headerTimeout, "http-header-timeout", cmd.httpServer.headerTimeout, "(HTTP only) (optional) Maximum time to read the request headers (defaults to 10s)")
+	flagset.UintVar(&cmd.httpServer.maxStreams, "http-max-streams", cmd.httpServer.maxStreams, "(HTTP only) (optional) Maximum number of concurrent HTTP/2 streams per connection (defaults to 250)")
+	flagset.StringVar(&cmd.httpClient.token, "http-token", cmd.httpClient.token, "(HTTP client only) (optional) Bearer token for the remote HTTP tunnel (env:<variable>, file:<path> or the token)")
+	flagset.StringVar(&cmd.httpClient.proxy, "http-proxy", cmd.httpClient.proxy, "(HTTP client only) (optional) HTTP proxy URL (defaults to the HTTP_PROXY/HTTPS_PROXY environment variables)")
+	flagset.BoolVar(&cmd.ipPersist, "ip-persist", cmd.ipPersist, "(IP/out only) Persists the learned controller addresses to the work folder")
+	flagset.DurationVar(&cmd.discoveryCache, "discovery-cache", cmd.discoveryCache, "(OUT only) (optional) Answers broadcast get-device requests from the replies received within the TTL (defaults to 0 i.e. disabled)")
+	flagset.DurationVar(&cmd.timeSync, "time-sync", cmd.timeSync, "(OUT only) (optional) Interval at which to set the time on the controllers in the [controllers] table from the host clock. Defaults to 0 (disabled)")
+	flagset.StringVar(&cmd.validate, "validate", cmd.validate, "(IN only) (optional) Validates the messages received by the IN connector (none, strict or passthrough). Defaults to none")
+	flagset.StringVar(&cmd.responseCache, "response-cache", cmd.responseCache, "(OUT only) (optional) Comma separated list of read-only functions and reply TTLs to cache e.g. get-status:2s,get-time:5s")
+	flagset.StringVar(&cmd.html, "html", cmd.html, "(optional) HTML folder for HTTP/HTTPS connectors (defaults to the embedded example web UI)")
 	flagset.StringVar(&cmd.workdir, "workdir", cmd.workdir, "work folder (for e.g. tailscale state)")
 	flagset.StringVar(&cmd.logLevel, "log-level", cmd.logLevel, "Sets the log level (debug, info, warn or error)")
 	flagset.BoolVar(&cmd.console, "console", cmd.console, "Runs as a console application rather than a service")
 	flagset.BoolVar(&cmd.debug, "debug", cmd.debug, "Enables detailed debugging logs")
+	flagset.StringVar(&cmd.debugFormat, "debug-format", cmd.debugFormat, "Format for UHPPOTE messages in the debugging logs (hex, decoded or both). Defaults to hex")
 	flagset.BoolVar(&cmd.daemon, "service", false, "(internal only) Expressly disables running a service in console mode")
 
 	return flagset
@@ -203,16 +295,48 @@ func (cmd *Run) ParseCmd(args ...string) error {
 
 		if p, ok := config["controllers"]; ok {
 			if q, ok := p.(map[string]any); ok {
-				m := map[uint32]string{}
+				m := map[uint32]conn.Controller{}
 				for k, v := range q {
-					if id, err := strconv.ParseUint(k, 10, 32); err == nil {
-						m[uint32(id)] = fmt.Sprintf("%v", v)
+					if id, err := strconv.ParseUint(k, 10, 32); err != nil {
+						continue
+					} else if controller, err := parseController(v); err != nil {
+						return fmt.Errorf("invalid controller %v (%v)", k, err)
+					} else {
+						m[uint32(id)] = controller
 					}
 				}
 
 				cmd.controllers = m
 			}
 		}
+
+		if p, ok := config["address-translation"]; ok {
+			if q, ok := p.(map[string]any); ok {
+				m := map[string]string{}
+				for k, v := range q {
+					m[k] = fmt.Sprintf("%v", v)
+				}
+
+				cmd.nat = m
+			}
+		}
+
+		if p, ok := config["serial-numbers"]; ok {
+			if q, ok := p.(map[string]any); ok {
+				m := map[uint32]uint32{}
+				for k, v := range q {
+					if controller, err := strconv.ParseUint(k, 10, 32); err != nil {
+						return fmt.Errorf("invalid serial number mapping controller '%v'", k)
+					} else if virtual, err := strconv.ParseUint(fmt.Sprintf("%v", v), 10, 32); err != nil {
+						return fmt.Errorf("invalid serial number mapping %v → '%v'", k, v)
+					} else {
+						m[uint32(controller)] = uint32(virtual)
+					}
+				}
+
+				cmd.serials = m
+			}
+		}
 	}
 
 	return nil
@@ -226,14 +350,62 @@ func (cmd *Run) execute(f func(t *tunnel.Tunnel, ctx context.Context, cancel con
 
 	defer cancel()
 
+	if err = conn.SetDumpFormat(cmd.debugFormat); err != nil {
+		return
+	}
+
+	if cmd.timeSync > 0 && !strings.HasPrefix(cmd.out, "udp/broadcast:") && !strings.HasPrefix(cmd.out, "ip/out:") {
+		return fmt.Errorf("--time-sync requires a udp/broadcast or ip/out OUT connector (%v)", cmd.out)
+	}
+
 	if in, err = cmd.makeInConn(ctx); err != nil {
 		return
 	}
 
+	if mode, err := validate.ParseMode(cmd.validate); err != nil {
+		return err
+	} else if mode != validate.None {
+		in = validate.NewValidator(in, mode, cmd.isEventTunnel())
+	}
+
 	if out, err = cmd.makeOutConn(ctx); err != nil {
 		return
 	}
 
+	if cmd.timeSync > 0 && !cmd.isEventTunnel() {
+		out = timesync.NewTimeSync(out, cmd.timeSync, cmd.controllers, cmd.udpTimeout, ctx)
+	}
+
+	if len(cmd.serials) > 0 {
+		if serials, err := nat.NewSerials(out, cmd.serials, cmd.isEventTunnel()); err != nil {
+			return err
+		} else {
+			out = serials
+		}
+	}
+
+	if len(cmd.nat) > 0 && !cmd.isEventTunnel() {
+		var table *nat.Table
+		if table, err = nat.NewTable(cmd.nat); err != nil {
+			return
+		} else {
+			out = nat.NewNAT(out, table)
+		}
+	}
+
+	if cmd.discoveryCache > 0 && !cmd.isEventTunnel() {
+		out = cache.NewDiscovery(out, cmd.discoveryCache)
+	}
+
+	if cmd.responseCache != "" && !cmd.isEventTunnel() {
+		var ttls map[byte]time.Duration
+		if ttls, err = cache.ParseTTLs(cmd.responseCache); err != nil {
+			return
+		} else if len(ttls) > 0 {
+			out = cache.NewResponses(out, ttls, cmd.udpTimeout)
+		}
+	}
+
 	// ... create lockfile
 	var lockfile = cmd.lockfile
 	var kraken lib.Lockfile
@@ -291,7 +463,7 @@ func (cmd *Run) makeInConn(ctx context.Context) (tunnel.Conn, error) {
 	}
 
 	// ... events tunnel ?
-	events := strings.HasPrefix(cmd.out, "udp/event")
+	events := strings.HasPrefix(cmd.out, "udp/event") || isHTTPEventOut(cmd.out)
 
 	// ... construct connection
 	switch {
@@ -339,7 +511,9 @@ func (cmd *Run) makeOutConn(ctx context.Context) (tunnel.Conn, error) {
 		strings.HasPrefix(spec, "tls/client:"),
 		strings.HasPrefix(spec, "tls/server:"),
 		strings.HasPrefix(spec, "tailscale/client:"),
-		strings.HasPrefix(spec, "ip/out:"):
+		strings.HasPrefix(spec, "ip/out:"),
+		strings.HasPrefix(spec, "http/"),
+		strings.HasPrefix(spec, "https/"):
 		return cmd.makeConn("--out", hwif, spec, Out, events, ctx)
 
 	default:
@@ -351,13 +525,18 @@ func (cmd Run) makeConn(arg, hwif string, spec string, dir direction, events boo
 	retry := conn.NewBackoff(cmd.maxRetries, cmd.maxRetryDelay, ctx)
 	switch {
 	case strings.HasPrefix(spec, "ip/out:"):
-		return ip.NewIPOut(hwif, spec[7:], cmd.controllers, cmd.udpTimeout, ctx)
+		learned := ""
+		if cmd.ipPersist {
+			learned = filepath.Join(cmd.workdir, "ip-out.json")
+		}
+
+		return ip.NewIPOut(hwif, spec[7:], cmd.controllers, learned, cmd.udpTimeout, cmd.udpRetries, ctx)
 
 	case strings.HasPrefix(spec, "udp/listen:"):
 		return udp.NewUDPListen(hwif, spec[11:], retry, ctx)
 
 	case strings.HasPrefix(spec, "udp/broadcast:"):
-		return udp.NewUDPBroadcast(hwif, spec[14:], cmd.udpTimeout, ctx)
+		return udp.NewUDPBroadcast(hwif, spec[14:], cmd.controllers, cmd.udpTimeout, cmd.udpRetries, ctx)
 
 	case strings.HasPrefix(spec, "udp/event:"):
 		switch {
@@ -370,31 +549,39 @@ func (cmd Run) makeConn(arg, hwif string, spec string, dir direction, events boo
 		}
 
 	case strings.HasPrefix(spec, "tcp/client:"):
-		switch {
-		case events && dir == In:
-			return tcp.NewTCPEventInClient(hwif, spec[11:], retry, ctx)
-		case events && dir == Out:
-			return tcp.NewTCPEventOutClient(hwif, spec[11:], retry, ctx)
-		case dir == In:
-			return tcp.NewTCPInClient(hwif, spec[11:], retry, ctx)
-		case dir == Out:
-			return tcp.NewTCPOutClient(hwif, spec[11:], retry, ctx)
-		default:
-			return nil, fmt.Errorf("invalid %v argument (%v)", arg, spec)
+		if key, err := psk.NewKey(cmd.psk); err != nil {
+			return nil, err
+		} else {
+			switch {
+			case events && dir == In:
+				return tcp.NewTCPEventInClient(hwif, spec[11:], key, retry, ctx)
+			case events && dir == Out:
+				return tcp.NewTCPEventOutClient(hwif, spec[11:], key, retry, ctx)
+			case dir == In:
+				return tcp.NewTCPInClient(hwif, spec[11:], key, retry, ctx)
+			case dir == Out:
+				return tcp.NewTCPOutClient(hwif, spec[11:], key, retry, ctx)
+			default:
+				return nil, fmt.Errorf("invalid %v argument (%v)", arg, spec)
+			}
 		}
 
 	case strings.HasPrefix(spec, "tcp/server:"):
-		switch {
-		case events && dir == In:
-			return tcp.NewTCPEventInServer(hwif, spec[11:], retry, ctx)
-		case events && dir == Out:
-			return tcp.NewTCPEventOutServer(hwif, spec[11:], retry, ctx)
-		case dir == In:
-			return tcp.NewTCPInServer(hwif, spec[11:], retry, ctx)
-		case dir == Out:
-			return tcp.NewTCPOutServer(hwif, spec[11:], retry, ctx)
-		default:
-			return nil, fmt.Errorf("invalid %v argument (%v)", arg, spec)
+		if key, err := psk.NewKey(cmd.psk); err != nil {
+			return nil, err
+		} else {
+			switch {
+			case events && dir == In:
+				return tcp.NewTCPEventInServer(hwif, spec[11:], key, retry, ctx)
+			case events && dir == Out:
+				return tcp.NewTCPEventOutServer(hwif, spec[11:], key, retry, ctx)
+			case dir == In:
+				return tcp.NewTCPInServer(hwif, spec[11:], key, retry, ctx)
+			case dir == Out:
+				return tcp.NewTCPOutServer(hwif, spec[11:], key, retry, ctx)
+			default:
+				return nil, fmt.Errorf("invalid %v argument (%v)", arg, spec)
+			}
 		}
 
 	case strings.HasPrefix(spec, "tls/client:"):
@@ -402,16 +589,20 @@ func (cmd Run) makeConn(arg, hwif string, spec string, dir direction, events boo
 			return nil, err
 		} else if certificate, err := tlsClientKeyPair(cmd.certificate, cmd.key); err != nil {
 			return nil, err
+		} else if options, err := cmd.tlsConfig(); err != nil {
+			return nil, err
+		} else if revocation, err := cmd.tlsRevocation(); err != nil {
+			return nil, err
 		} else {
 			switch {
 			case events && dir == In:
-				return tls.NewTLSEventInClient(hwif, spec[11:], ca, certificate, retry, ctx)
+				return tls.NewTLSEventInClient(hwif, spec[11:], ca, certificate, options, revocation, retry, ctx)
 			case events && dir == Out:
-				return tls.NewTLSEventOutClient(hwif, spec[11:], ca, certificate, retry, ctx)
+				return tls.NewTLSEventOutClient(hwif, spec[11:], ca, certificate, options, revocation, retry, ctx)
 			case dir == In:
-				return tls.NewTLSInClient(hwif, spec[11:], ca, certificate, retry, ctx)
+				return tls.NewTLSInClient(hwif, spec[11:], ca, certificate, options, revocation, retry, ctx)
 			case dir == Out:
-				return tls.NewTLSOutClient(hwif, spec[11:], ca, certificate, retry, ctx)
+				return tls.NewTLSOutClient(hwif, spec[11:], ca, certificate, options, revocation, retry, ctx)
 			default:
 				return nil, fmt.Errorf("invalid %v argument (%v)", arg, spec)
 			}
@@ -422,32 +613,114 @@ func (cmd Run) makeConn(arg, hwif string, spec string, dir direction, events boo
 			return nil, err
 		} else if certificate, err := tlsServerKeyPair(cmd.certificate, cmd.key); err != nil {
 			return nil, err
+		} else if options, err := cmd.tlsConfig(); err != nil {
+			return nil, err
+		} else if revocation, err := cmd.tlsRevocation(); err != nil {
+			return nil, err
+		} else if permissions, err := acl.Load(cmd.acl); err != nil {
+			return nil, err
 		} else {
 			switch {
 			case events && dir == In:
-				return tls.NewTLSEventInServer(hwif, spec[11:], ca, *certificate, cmd.requireClientAuth, retry, ctx)
+				return tls.NewTLSEventInServer(hwif, spec[11:], ca, *certificate, cmd.requireClientAuth, options, revocation, retry, ctx)
 			case events && dir == Out:
-				return tls.NewTLSEventOutServer(hwif, spec[11:], ca, *certificate, cmd.requireClientAuth, retry, ctx)
+				return tls.NewTLSEventOutServer(hwif, spec[11:], ca, *certificate, cmd.requireClientAuth, options, revocation, retry, ctx)
 			case dir == In:
-				return tls.NewTLSInServer(hwif, spec[11:], ca, *certificate, cmd.requireClientAuth, retry, ctx)
+				return tls.NewTLSInServer(hwif, spec[11:], ca, *certificate, cmd.requireClientAuth, options, revocation, permissions, retry, ctx)
 			case dir == Out:
-				return tls.NewTLSOutServer(hwif, spec[11:], ca, *certificate, cmd.requireClientAuth, retry, ctx)
+				return tls.NewTLSOutServer(hwif, spec[11:], ca, *certificate, cmd.requireClientAuth, options, revocation, retry, ctx)
 			default:
 				return nil, fmt.Errorf("invalid %v argument (%v)", arg, spec)
 			}
 		}
 
+	case strings.HasPrefix(spec, "http/client:"):
+		if dir != Out {
+			return nil, fmt.Errorf("invalid %v argument (%v)", arg, spec)
+		} else if ca, err := cmd.httpClientCA(); err != nil {
+			return nil, err
+		} else if certificate, err := tlsClientKeyPair(cmd.certificate, cmd.key); err != nil {
+			return nil, err
+		} else if options, err := cmd.tlsConfig(); err != nil {
+			return nil, err
+		} else {
+			return http.NewHTTPClient(spec[12:], ca, certificate, options, cmd.httpClient.token, cmd.httpClient.proxy, cmd.udpTimeout, ctx)
+		}
+
+	case strings.HasPrefix(spec, "http/poll:"):
+		if dir != In {
+			return nil, fmt.Errorf("invalid %v argument (%v)", arg, spec)
+		} else if ca, err := cmd.httpClientCA(); err != nil {
+			return nil, err
+		} else if certificate, err := tlsClientKeyPair(cmd.certificate, cmd.key); err != nil {
+			return nil, err
+		} else if options, err := cmd.tlsConfig(); err != nil {
+			return nil, err
+		} else {
+			return http.NewHTTPPoll(spec[10:], ca, certificate, options, cmd.httpClient.token, cmd.httpClient.proxy, retry, ctx)
+		}
+
+	case strings.HasPrefix(spec, "http/reverse:"):
+		if dir != Out {
+			return nil, fmt.Errorf("invalid %v argument (%v)", arg, spec)
+		} else if cmd.httpAuth == "" {
+			return nil, fmt.Errorf("%v requires --http-auth", spec)
+		} else if authentication, err := auth.Load(cmd.httpAuth); err != nil {
+			return nil, err
+		} else {
+			return http.NewHTTPReverse(spec[13:], cmd.html, authentication, cmd.httpSecurityPolicy(), cmd.httpServerSettings(), cmd.udpTimeout, retry, ctx)
+		}
+
+	case strings.HasPrefix(spec, "https/reverse:"):
+		if dir != Out {
+			return nil, fmt.Errorf("invalid %v argument (%v)", arg, spec)
+		} else if cmd.httpAuth == "" {
+			return nil, fmt.Errorf("%v requires --http-auth", spec)
+		} else if certificates, err := pki.NewACME(cmd.acme.hosts, cmd.acme.directory, cmd.acme.email, cmd.acme.challenge, cmd.acme.ca, cmd.workdir); err != nil {
+			return nil, err
+		} else if ca, err := cmd.httpsCA(certificates != nil); err != nil {
+			return nil, err
+		} else if certificate, err := cmd.httpsKeyPair(certificates != nil); err != nil {
+			return nil, err
+		} else if options, err := cmd.tlsConfig(); err != nil {
+			return nil, err
+		} else if revocation, err := cmd.tlsRevocation(); err != nil {
+			return nil, err
+		} else if authentication, err := auth.Load(cmd.httpAuth); err != nil {
+			return nil, err
+		} else {
+			return http.NewHTTPSReverse(spec[14:], cmd.html, ca, *certificate, cmd.requireClientAuth, options, revocation, certificates, authentication, cmd.httpSecurityPolicy(), cmd.httpServerSettings(), cmd.udpTimeout, retry, ctx)
+		}
+
 	case strings.HasPrefix(spec, "http/"):
-		return http.NewHTTP(spec[5:], cmd.html, retry, ctx)
+		if authentication, err := auth.Load(cmd.httpAuth); err != nil {
+			return nil, err
+		} else if dir == Out {
+			return http.NewHTTPEventOut(spec[5:], cmd.html, authentication, cmd.httpSecurityPolicy(), cmd.httpServerSettings(), retry, ctx)
+		} else {
+			return http.NewHTTP(spec[5:], cmd.html, authentication, cmd.httpSecurityPolicy(), cmd.httpServerSettings(), retry, ctx)
+		}
 
 	case strings.HasPrefix(spec, "https/"):
-		if ca, err := tlsCA(cmd.caCertificate); err != nil {
+		if certificates, err := pki.NewACME(cmd.acme.hosts, cmd.acme.directory, cmd.acme.email, cmd.acme.challenge, cmd.acme.ca, cmd.workdir); err != nil {
 			return nil, err
-		} else if certificate, err := tlsServerKeyPair(cmd.certificate, cmd.key); err != nil {
+		} else if ca, err := cmd.httpsCA(certificates != nil); err != nil {
+			return nil, err
+		} else if certificate, err := cmd.httpsKeyPair(certificates != nil); err != nil {
+			return nil, err
+		} else if options, err := cmd.tlsConfig(); err != nil {
+			return nil, err
+		} else if revocation, err := cmd.tlsRevocation(); err != nil {
+			return nil, err
+		} else if permissions, err := acl.Load(cmd.acl); err != nil {
+			return nil, err
+		} else if authentication, err := auth.Load(cmd.httpAuth); err != nil {
 			return nil, err
+		} else if dir == Out {
+			return http.NewHTTPSEventOut(spec[6:], cmd.html, ca, *certificate, cmd.requireClientAuth, options, revocation, certificates, authentication, cmd.httpSecurityPolicy(), cmd.httpServerSettings(), retry, ctx)
 		} else {
 			fmt.Printf("%v\n%v\n%v\n%v\n", cmd.caCertificate, cmd.certificate, cmd.key, cmd.requireClientAuth)
-			return http.NewHTTPS(spec[6:], cmd.html, ca, *certificate, cmd.requireClientAuth, retry, ctx)
+			return http.NewHTTPS(spec[6:], cmd.html, ca, *certificate, cmd.requireClientAuth, options, revocation, permissions, certificates, authentication, cmd.httpSecurityPolicy(), cmd.httpServerSettings(), retry, ctx)
 		}
 
 	case strings.HasPrefix(spec, "tailscale/server:"):
@@ -503,6 +776,138 @@ func (cmd *Run) run(t *tunnel.Tunnel, ctx context.Context, cancel context.Cancel
 	wg.Wait()
 }
 
+func (cmd Run) tlsConfig() (*pki.Options, error) {
+	return pki.NewOptions(
+		cmd.tlsOptions.minVersion,
+		cmd.tlsOptions.maxVersion,
+		cmd.tlsOptions.ciphers,
+		cmd.tlsOptions.curves,
+		cmd.tlsOptions.alpn,
+		cmd.tlsOptions.serverName,
+		cmd.tlsOptions.pins)
+}
+
+func (cmd Run) tlsRevocation() (*pki.Revocation, error) {
+	if cmd.crl == "" && !cmd.ocsp {
+		return nil, nil
+	}
+
+	cacert := cmd.caCertificate
+	if cacert == "" {
+		cacert = "ca.cert"
+	}
+
+	if issuers, err := pki.Certificates(cacert); err != nil {
+		return nil, err
+	} else {
+		return pki.NewRevocation(cmd.crl, cmd.ocsp, issuers)
+	}
+}
+
+func (cmd Run) httpSecurityPolicy() *http.Policy {
+	return http.NewPolicy(cmd.httpPolicy.origins, cmd.httpPolicy.methods, cmd.httpPolicy.csrf, cmd.httpPolicy.csp)
+}
+
+func (cmd Run) httpServerSettings() *http.Server {
+	return http.NewServer(cmd.httpServer.readTimeout, cmd.httpServer.writeTimeout, cmd.httpServer.idleTimeout, cmd.httpServer.headerTimeout, uint32(cmd.httpServer.maxStreams))
+}
+
+// parseController parses a TOML [controllers] table entry, which is either the controller address or a
+// table with an (optional) address, (optional) request timeout and (optional) timezone e.g.
+//
+//	405419896 = "udp::192.168.1.100:60000"
+//	303986753 = { address = "tcp::192.168.1.101:60000", timeout = "2s" }
+//	201020304 = { timeout = "10s", timezone = "Europe/Berlin" }
+func parseController(v any) (conn.Controller, error) {
+	controller := conn.Controller{}
+
+	switch t := v.(type) {
+	case string:
+		controller.Address = t
+
+	case map[string]any:
+		if address, ok := t["address"]; ok {
+			controller.Address = fmt.Sprintf("%v", address)
+		}
+
+		if timeout, ok := t["timeout"]; ok {
+			if d, err := time.ParseDuration(fmt.Sprintf("%v", timeout)); err != nil {
+				return controller, err
+			} else if d <= 0 {
+				return controller, fmt.Errorf("invalid timeout '%v'", timeout)
+			} else {
+				controller.Timeout = d
+			}
+		}
+
+		if timezone, ok := t["timezone"]; ok {
+			if location, err := time.LoadLocation(fmt.Sprintf("%v", timezone)); err != nil {
+				return controller, err
+			} else {
+				controller.Location = location
+			}
+		}
+
+	default:
+		return controller, fmt.Errorf("invalid controller settings '%v'", v)
+	}
+
+	return controller, nil
+}
+
+// isEventTunnel returns true if the tunnel relays controller events rather than requests and replies.
+func (cmd Run) isEventTunnel() bool {
+	return strings.HasPrefix(cmd.in, "udp/event") || strings.HasPrefix(cmd.out, "udp/event") || isHTTPEventOut(cmd.out)
+}
+
+// isHTTPEventOut returns true if the --out connector is an HTTP/HTTPS server i.e. publishes the events
+// received by the IN connector to the /events subscribers.
+func isHTTPEventOut(spec string) bool {
+	switch {
+	case
+		strings.HasPrefix(spec, "http/client:"),
+		strings.HasPrefix(spec, "http/reverse:"),
+		strings.HasPrefix(spec, "https/reverse:"):
+		return false
+
+	default:
+		return strings.HasPrefix(spec, "http/") || strings.HasPrefix(spec, "https/")
+	}
+}
+
+// httpClientCA loads the CA used to verify the remote HTTPS tunnel. The CA certificate is optional and
+// the system root CAs are used if it is not provided.
+func (cmd Run) httpClientCA() (*x509.CertPool, error) {
+	if cmd.caCertificate == "" || cmd.caCertificate == "ca.cert" {
+		if _, err := os.Stat("ca.cert"); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+
+	return tlsCA(cmd.caCertificate)
+}
+
+// httpsCA loads the CA used to verify client certificates. With ACME the CA certificate is optional
+// unless client authentication is required.
+func (cmd Run) httpsCA(acme bool) (*x509.CertPool, error) {
+	if acme && !cmd.requireClientAuth && (cmd.caCertificate == "" || cmd.caCertificate == "ca.cert") {
+		if _, err := os.Stat("ca.cert"); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+
+	return tlsCA(cmd.caCertificate)
+}
+
+// httpsKeyPair loads the HTTPS server certificate unless it is provisioned using ACME.
+func (cmd Run) httpsKeyPair(acme bool) (*TLS.Certificate, error) {
+	if acme {
+		return &TLS.Certificate{}, nil
+	}
+
+	return tlsServerKeyPair(cmd.certificate, cmd.key)
+}
+
 func tlsCA(cacert string) (*x509.CertPool, error) {
 	if cacert == "" {
 		cacert = "ca.cert"
@@ -13,6 +13,7 @@ import (
 	"github.com/uhppoted/uhppoted-lib/config"
 	"github.com/uhppoted/uhppoted-lib/eventlog"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
 
 var RUN = Run{
@@ -25,7 +26,7 @@ var RUN = Run{
 	certificate:       "",
 	key:               "",
 	requireClientAuth: false,
-	html:              "./html",
+	html:              "",
 	lockfile: config.Lockfile{
 		File:   DefaultLockfile,
 		Remove: false,
@@ -43,7 +44,7 @@ var RUN = Run{
 	rateLimit:  1,
 	burstLimit: 120,
 
-	controllers: map[uint32]string{},
+	controllers: map[uint32]conn.Controller{},
 }
 
 func (cmd *Run) FlagSet() *flag.FlagSet {
@@ -19,6 +19,7 @@ import (
 	"github.com/uhppoted/uhppoted-lib/eventlog"
 
 	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
 
 var RUN = Run{
@@ -31,7 +32,7 @@ var RUN = Run{
 	certificate:       "",
 	key:               "",
 	requireClientAuth: false,
-	html:              "./html",
+	html:              "",
 	lockfile: config.Lockfile{
 		File:   DefaultLockfile,
 		Remove: true,
@@ -49,7 +50,7 @@ var RUN = Run{
 	rateLimit:  1,
 	burstLimit: 120,
 
-	controllers: map[uint32]string{},
+	controllers: map[uint32]conn.Controller{},
 }
 
 type service struct {
@@ -0,0 +1,10 @@
+// Package examples embeds the example HTTP connector web UI, which is served by the HTTP and HTTPS
+// connectors if an HTML folder is not specified.
+package examples
+
+import (
+	"embed"
+)
+
+//go:embed html
+var HTML embed.FS
@@ -14,7 +14,7 @@ export function broadcast (bytes) {
     mode: 'cors',
     cache: 'no-cache',
     credentials: 'same-origin',
-    headers: { 'Content-Type': 'application/json' },
+    headers: headers(),
     redirect: 'follow',
     referrerPolicy: 'no-referrer',
     body: JSON.stringify(rq)
@@ -53,7 +53,7 @@ export function send (bytes, nowait) {
     mode: 'cors',
     cache: 'no-cache',
     credentials: 'same-origin',
-    headers: { 'Content-Type': 'application/json' },
+    headers: headers(),
     redirect: 'follow',
     referrerPolicy: 'no-referrer',
     body: JSON.stringify(rq)
@@ -82,6 +82,20 @@ export function send (bytes, nowait) {
     })
 }
 
+function headers () {
+  const headers = { 'Content-Type': 'application/json' }
+  const csrf = document.cookie
+    .split(';')
+    .map(c => c.trim())
+    .find(c => c.startsWith('uhppoted-tunnel-csrf='))
+
+  if (csrf) {
+    headers['X-CSRF-Token'] = csrf.substring('uhppoted-tunnel-csrf='.length)
+  }
+
+  return headers
+}
+
 function nextID () {
   REQUESTID++
 
@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+// Function names for the UHPPOTE function codes, as used in the TOML configuration.
+var functions = map[byte]string{
+	0x20: "get-status",
+	0x30: "set-time",
+	0x32: "get-time",
+	0x40: "open-door",
+	0x50: "put-card",
+	0x52: "delete-card",
+	0x54: "delete-all-cards",
+	0x58: "get-cards",
+	0x5a: "get-card",
+	0x5c: "get-card-by-index",
+	0x80: "set-door-control",
+	0x82: "get-door-control",
+	0x88: "set-time-profile",
+	0x8a: "clear-time-profiles",
+	0x8c: "set-door-passcodes",
+	0x8e: "record-special-events",
+	0x90: "set-listener",
+	0x92: "get-listener",
+	0x94: "get-device",
+	0x96: "set-address",
+	0x98: "get-time-profile",
+	0xa0: "set-pc-control",
+	0xa2: "set-interlock",
+	0xa4: "activate-keypads",
+	0xa6: "clear-task-list",
+	0xa8: "add-task",
+	0xaa: "set-first-card",
+	0xac: "refresh-task-list",
+	0xb0: "get-event",
+	0xb2: "set-event-index",
+	0xb4: "get-event-index",
+	0xc8: "restore-default-parameters",
+}
+
+// FunctionName returns the function name for a UHPPOTE function code.
+func FunctionName(code byte) string {
+	if name, ok := functions[code]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("0x%02x", code)
+}
+
+// FunctionCode returns the UHPPOTE function code for a function name.
+func FunctionCode(name string) (byte, bool) {
+	for k, v := range functions {
+		if v == name {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
+
+// IsFunction returns true if the code is a known UHPPOTE function code.
+func IsFunction(code byte) bool {
+	_, ok := functions[code]
+
+	return ok
+}
+
+// Idempotent function codes i.e. requests that only retrieve information from a controller and can be
+// resent safely if the reply is lost.
+var idempotent = map[byte]bool{
+	0x20: true, // get-status
+	0x32: true, // get-time
+	0x58: true, // get-cards
+	0x5a: true, // get-card
+	0x5c: true, // get-card-by-index
+	0x82: true, // get-door-control
+	0x92: true, // get-listener
+	0x94: true, // get-device
+	0x98: true, // get-time-profile
+	0xb0: true, // get-event
+	0xb4: true, // get-event-index
+}
+
+// IsIdempotent returns true if a request with the function code can be resent without side effects.
+func IsIdempotent(code byte) bool {
+	return idempotent[code]
+}
+
+// Validate checks that a message is a UHPPOTE message i.e. 64 bytes long with a 0x17 start of message byte
+// and a known function code. Events may also have the 0x19 start of message byte used by V6.62 firmware
+// and must have the 0x20 function code.
+func Validate(message []byte, event bool) error {
+	switch {
+	case len(message) != 64:
+		return fmt.Errorf("invalid message length (%v bytes)", len(message))
+
+	case message[0] != 0x17 && (!event || message[0] != 0x19):
+		return fmt.Errorf("invalid start of message (0x%02x)", message[0])
+
+	case event && message[1] != 0x20:
+		return fmt.Errorf("invalid event function code (0x%02x)", message[1])
+
+	case !IsFunction(message[1]):
+		return fmt.Errorf("unknown function code (0x%02x)", message[1])
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestIsIdempotent(t *testing.T) {
+	tests := []struct {
+		function   string
+		idempotent bool
+	}{
+		{"get-status", true},
+		{"get-device", true},
+		{"get-card", true},
+		{"get-event", true},
+		{"open-door", false},
+		{"put-card", false},
+		{"set-time", false},
+		{"set-event-index", false},
+		{"restore-default-parameters", false},
+	}
+
+	for _, test := range tests {
+		code, ok := FunctionCode(test.function)
+		if !ok {
+			t.Fatalf("unknown function %v", test.function)
+		}
+
+		if IsIdempotent(code) != test.idempotent {
+			t.Errorf("incorrect idempotent flag for %v - expected:%v, got:%v", test.function, test.idempotent, IsIdempotent(code))
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	message := func(som, function byte, N int) []byte {
+		m := make([]byte, N)
+		m[0] = som
+		m[1] = function
+
+		return m
+	}
+
+	tests := []struct {
+		message []byte
+		event   bool
+		valid   bool
+	}{
+		{message(0x17, 0x94, 64), false, true},
+		{message(0x17, 0x20, 64), true, true},
+		{message(0x19, 0x20, 64), true, true},
+		{message(0x17, 0x94, 63), false, false},
+		{message(0x17, 0x94, 1024), false, false},
+		{message(0x18, 0x94, 64), false, false},
+		{message(0x19, 0x94, 64), false, false},
+		{message(0x17, 0xff, 64), false, false},
+		{message(0x17, 0x94, 64), true, false},
+	}
+
+	for _, test := range tests {
+		if err := Validate(test.message, test.event); (err == nil) != test.valid {
+			t.Errorf("incorrect validation for %v bytes %02x %02x (event:%v) - expected:%v, got:%v", len(test.message), test.message[0], test.message[1], test.event, test.valid, err)
+		}
+	}
+}
@@ -11,7 +11,8 @@ import (
 )
 
 type Switch struct {
-	relay func(uint32, []byte)
+	relay  func(uint32, []byte)
+	filter func(uint32, []byte) []byte
 }
 
 type Router struct {
@@ -73,7 +74,32 @@ func NewSwitch(f func(uint32, []byte)) Switch {
 	}
 }
 
+// Filter returns a copy of the switch that applies f to the received messages before they are routed
+// and before any existing filter, i.e. a connector wrapped by several connectors has the filter of the
+// innermost wrapper applied first. Messages for which f returns nil are discarded.
+func (s Switch) Filter(f func(uint32, []byte) []byte) Switch {
+	if g := s.filter; g != nil {
+		s.filter = func(id uint32, message []byte) []byte {
+			if message = f(id, message); message != nil {
+				return g(id, message)
+			}
+
+			return nil
+		}
+	} else {
+		s.filter = f
+	}
+
+	return s
+}
+
 func (s *Switch) Received(id uint32, message []byte, h func([]byte)) {
+	if s.filter != nil && message != nil {
+		if message = s.filter(id, message); message == nil {
+			return
+		}
+	}
+
 	if !limiter.Allow() {
 		warnf("ROUTER", "rate limit exceeded")
 		return
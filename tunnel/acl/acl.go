@@ -0,0 +1,228 @@
+package acl
+
+import (
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/uhppoted/uhppoted-tunnel/log"
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+)
+
+// ACL maps client certificate identities (subject, SAN or SPIFFE ID) to the controllers and
+// functions a client is permitted to access.
+type ACL struct {
+	file  string
+	rules []rule
+}
+
+type rule struct {
+	identity    string
+	controllers map[uint32]struct{}
+	functions   map[byte]struct{}
+}
+
+// Load reads an ACL TOML file, e.g.
+//
+//	[[identity]]
+//	identity = "spiffe://uhppoted/site/workshop"
+//	controllers = [ 405419896, 303986753 ]
+//	functions = [ "get-status", "get-time", "open-door" ]
+//
+// Controllers and functions may be '*' to allow all controllers/functions and functions may be
+// specified by name or by function code. An omitted functions list allows all functions.
+func Load(file string) (*ACL, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	c := struct {
+		Identities []struct {
+			Identity    string `toml:"identity"`
+			Controllers []any  `toml:"controllers"`
+			Functions   []any  `toml:"functions"`
+		} `toml:"identity"`
+	}{}
+
+	if err := toml.Unmarshal(bytes, &c); err != nil {
+		return nil, fmt.Errorf("invalid ACL file %v (%v)", file, err)
+	}
+
+	acl := ACL{
+		file:  file,
+		rules: []rule{},
+	}
+
+	for _, v := range c.Identities {
+		r := rule{
+			identity: strings.TrimSpace(v.Identity),
+		}
+
+		if r.identity == "" {
+			return nil, fmt.Errorf("invalid ACL file %v (missing identity)", file)
+		}
+
+		if controllers, err := parseControllers(v.Controllers); err != nil {
+			return nil, fmt.Errorf("invalid ACL for %v (%v)", r.identity, err)
+		} else {
+			r.controllers = controllers
+		}
+
+		if v.Functions != nil {
+			if functions, err := parseFunctions(v.Functions); err != nil {
+				return nil, fmt.Errorf("invalid ACL for %v (%v)", r.identity, err)
+			} else {
+				r.functions = functions
+			}
+		}
+
+		acl.rules = append(acl.rules, r)
+	}
+
+	infof("loaded %v ACL identities from %v", len(acl.rules), file)
+
+	return &acl, nil
+}
+
+// Allow returns an error if the request is not permitted for the client certificate. Requests from
+// clients without a certificate or with a certificate that does not match any identity are rejected.
+func (acl *ACL) Allow(certificate *x509.Certificate, request []byte) error {
+	if acl == nil {
+		return nil
+	}
+
+	if certificate == nil {
+		return fmt.Errorf("request rejected - no client certificate")
+	}
+
+	if len(request) < 8 {
+		return fmt.Errorf("request rejected - invalid request (%v bytes)", len(request))
+	}
+
+	function := request[1]
+	controller := binary.LittleEndian.Uint32(request[4:])
+	identities := Identities(certificate)
+
+	for _, r := range acl.rules {
+		for _, identity := range identities {
+			if r.identity == identity && r.allows(controller, function) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("request rejected - %v not permitted for controller %v (%v)",
+		protocol.FunctionName(function),
+		controller,
+		certificate.Subject)
+}
+
+// Identities returns the list of identities for a certificate i.e. the subject DN, the subject
+// common name and all the subject alternative names (including URIs, which is where a SPIFFE ID
+// is held).
+func Identities(certificate *x509.Certificate) []string {
+	identities := []string{
+		certificate.Subject.String(),
+	}
+
+	if certificate.Subject.CommonName != "" {
+		identities = append(identities, certificate.Subject.CommonName)
+	}
+
+	identities = append(identities, certificate.DNSNames...)
+	identities = append(identities, certificate.EmailAddresses...)
+
+	for _, uri := range certificate.URIs {
+		identities = append(identities, uri.String())
+	}
+
+	for _, ip := range certificate.IPAddresses {
+		identities = append(identities, ip.String())
+	}
+
+	return identities
+}
+
+func (r rule) allows(controller uint32, function byte) bool {
+	if r.controllers != nil {
+		if _, ok := r.controllers[controller]; !ok {
+			return false
+		}
+	}
+
+	if r.functions != nil {
+		if _, ok := r.functions[function]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseControllers(list []any) (map[uint32]struct{}, error) {
+	controllers := map[uint32]struct{}{}
+
+	for _, v := range list {
+		switch c := v.(type) {
+		case string:
+			if c == "*" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("invalid controller '%v'", c)
+
+		case int64:
+			if c < 0 || c > 0xffffffff {
+				return nil, fmt.Errorf("invalid controller '%v'", c)
+			}
+			controllers[uint32(c)] = struct{}{}
+
+		default:
+			return nil, fmt.Errorf("invalid controller '%v'", v)
+		}
+	}
+
+	return controllers, nil
+}
+
+func parseFunctions(list []any) (map[byte]struct{}, error) {
+	functions := map[byte]struct{}{}
+
+	for _, v := range list {
+		switch f := v.(type) {
+		case string:
+			if f == "*" {
+				return nil, nil
+			} else if code, ok := protocol.FunctionCode(f); !ok {
+				return nil, fmt.Errorf("unknown function '%v'", f)
+			} else {
+				functions[code] = struct{}{}
+			}
+
+		case int64:
+			if f < 0 || f > 0xff {
+				return nil, fmt.Errorf("invalid function code '%v'", f)
+			}
+			functions[byte(f)] = struct{}{}
+
+		default:
+			return nil, fmt.Errorf("invalid function '%v'", v)
+		}
+	}
+
+	return functions, nil
+}
+
+func infof(format string, args ...any) {
+	f := fmt.Sprintf("%-10v %v", "ACL", format)
+
+	log.Infof(f, args...)
+}
@@ -0,0 +1,73 @@
+package acl
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const TOML = `
+[[identity]]
+identity = "spiffe://uhppoted/site/workshop"
+controllers = [ 405419896 ]
+functions = [ "get-status", 0x40 ]
+
+[[identity]]
+identity = "CN=admin"
+controllers = [ "*" ]
+`
+
+func TestAllow(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "acl.toml")
+	if err := os.WriteFile(file, []byte(TOML), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	acl, err := Load(file)
+	if err != nil {
+		t.Fatalf("error loading ACL (%v)", err)
+	}
+
+	workshop := x509.Certificate{
+		Subject: pkix.Name{CommonName: "workshop"},
+		URIs:    []*url.URL{{Scheme: "spiffe", Host: "uhppoted", Path: "/site/workshop"}},
+	}
+
+	admin := x509.Certificate{
+		Subject: pkix.Name{CommonName: "admin"},
+	}
+
+	tests := []struct {
+		certificate *x509.Certificate
+		function    byte
+		controller  uint32
+		allowed     bool
+	}{
+		{&workshop, 0x20, 405419896, true},
+		{&workshop, 0x40, 405419896, true},
+		{&workshop, 0x50, 405419896, false},
+		{&workshop, 0x40, 303986753, false},
+		{&admin, 0x50, 303986753, true},
+		{nil, 0x20, 405419896, false},
+	}
+
+	for _, test := range tests {
+		request := make([]byte, 64)
+		request[0] = 0x17
+		request[1] = test.function
+		request[4] = byte(test.controller)
+		request[5] = byte(test.controller >> 8)
+		request[6] = byte(test.controller >> 16)
+		request[7] = byte(test.controller >> 24)
+
+		err := acl.Allow(test.certificate, request)
+		if test.allowed && err != nil {
+			t.Errorf("expected 0x%02x to controller %v to be allowed (%v)", test.function, test.controller, err)
+		} else if !test.allowed && err == nil {
+			t.Errorf("expected 0x%02x to controller %v to be rejected", test.function, test.controller)
+		}
+	}
+}
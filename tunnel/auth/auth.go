@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/uhppoted/uhppoted-tunnel/log"
+)
+
+// Auth authenticates HTTP requests using basic authentication (with users defined in the auth file
+// or in an htpasswd file), static bearer tokens or JWT bearer tokens verified against a JWKS file.
+// Each user, token or JWT subject can be restricted to a list of endpoints.
+type Auth struct {
+	users  map[string]user
+	tokens []token
+	jwt    *verifier
+}
+
+// Principal is an authenticated user, bearer token or JWT subject along with the endpoints it is
+// permitted to use (nil for all endpoints).
+type Principal struct {
+	Name      string
+	endpoints []string
+}
+
+type user struct {
+	password  string
+	endpoints []string
+}
+
+type token struct {
+	name      string
+	hash      []byte
+	endpoints []string
+}
+
+const REALM = "uhppoted-tunnel"
+
+// Load reads an HTTP authentication TOML file, e.g.
+//
+//	htpasswd = "uhppoted-tunnel.htpasswd"
+//
+//	[[user]]
+//	name = "admin"
+//	password = "$2y$10$..."
+//	endpoints = [ "*" ]
+//
+//	[[token]]
+//	name = "portal"
+//	token = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+//	endpoints = [ "/udp/send" ]
+//
+//	[jwt]
+//	jwks = "jwks.json"
+//	issuer = "https://idp.example.com"
+//	audience = "uhppoted-tunnel"
+//	endpoints = [ "/udp/send" ]
+//
+//	[[jwt.subject]]
+//	name = "operator"
+//	endpoints = [ "/udp/broadcast", "/udp/send" ]
+//
+// Passwords are bcrypt or {SHA} hashes (as generated by htpasswd). Tokens are either the token or the
+// SHA-256 hash of the token. Endpoints are path prefixes, with an omitted list allowing all endpoints.
+// JWT subjects are restricted to the [jwt] endpoints unless the subject has a [[jwt.subject]] entry (the
+// [[user]] entries do not apply to JWT subjects). Relative file paths are relative to the auth file.
+func Load(file string) (*Auth, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	c := struct {
+		Htpasswd string `toml:"htpasswd"`
+		Users    []struct {
+			Name      string   `toml:"name"`
+			Password  string   `toml:"password"`
+			Endpoints []string `toml:"endpoints"`
+		} `toml:"user"`
+		Tokens []struct {
+			Name      string   `toml:"name"`
+			Token     string   `toml:"token"`
+			Endpoints []string `toml:"endpoints"`
+		} `toml:"token"`
+		JWT *struct {
+			JWKS      string   `toml:"jwks"`
+			Issuer    string   `toml:"issuer"`
+			Audience  string   `toml:"audience"`
+			Endpoints []string `toml:"endpoints"`
+			Subjects  []struct {
+				Name      string   `toml:"name"`
+				Endpoints []string `toml:"endpoints"`
+			} `toml:"subject"`
+		} `toml:"jwt"`
+	}{}
+
+	if err := toml.Unmarshal(bytes, &c); err != nil {
+		return nil, fmt.Errorf("invalid HTTP auth file %v (%v)", file, err)
+	}
+
+	auth := Auth{
+		users:  map[string]user{},
+		tokens: []token{},
+	}
+
+	if c.Htpasswd != "" {
+		if users, err := htpasswd(relative(file, c.Htpasswd)); err != nil {
+			return nil, err
+		} else {
+			for k, v := range users {
+				auth.users[k] = user{password: v}
+			}
+		}
+	}
+
+	for _, u := range c.Users {
+		name := strings.TrimSpace(u.Name)
+		if name == "" {
+			return nil, fmt.Errorf("invalid HTTP auth file %v (missing user name)", file)
+		} else if strings.Contains(name, ":") {
+			return nil, fmt.Errorf("invalid HTTP auth file %v (invalid user name '%v')", file, name)
+		}
+
+		v := auth.users[name]
+		if u.Password != "" {
+			v.password = u.Password
+		}
+		v.endpoints = u.Endpoints
+
+		auth.users[name] = v
+	}
+
+	names := map[string]bool{}
+	for _, t := range c.Tokens {
+		name := strings.TrimSpace(t.Name)
+		if name == "" {
+			return nil, fmt.Errorf("invalid HTTP auth file %v (missing token name)", file)
+		} else if names[name] {
+			return nil, fmt.Errorf("invalid HTTP auth file %v (duplicate token name '%v')", file, name)
+		} else if t.Token == "" {
+			return nil, fmt.Errorf("invalid HTTP auth file %v (missing token for %v)", file, name)
+		}
+
+		names[name] = true
+
+		v := token{
+			name:      name,
+			endpoints: t.Endpoints,
+		}
+
+		if strings.HasPrefix(t.Token, "sha256:") {
+			if hash, err := hex.DecodeString(t.Token[7:]); err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid HTTP auth file %v (invalid token hash for %v)", file, t.Name)
+			} else {
+				v.hash = hash
+			}
+		} else {
+			hash := sha256.Sum256([]byte(t.Token))
+			v.hash = hash[:]
+		}
+
+		auth.tokens = append(auth.tokens, v)
+	}
+
+	if c.JWT != nil && c.JWT.JWKS != "" {
+		subjects := map[string][]string{}
+		for _, s := range c.JWT.Subjects {
+			if name := strings.TrimSpace(s.Name); name == "" {
+				return nil, fmt.Errorf("invalid HTTP auth file %v (missing JWT subject name)", file)
+			} else {
+				subjects[name] = s.Endpoints
+			}
+		}
+
+		if v, err := newVerifier(relative(file, c.JWT.JWKS), c.JWT.Issuer, c.JWT.Audience, c.JWT.Endpoints, subjects); err != nil {
+			return nil, err
+		} else {
+			auth.jwt = v
+		}
+	}
+
+	infof("loaded %v users, %v tokens from %v", len(auth.users), len(auth.tokens), file)
+
+	return &auth, nil
+}
+
+// Authenticate returns the user, token or JWT subject authenticated by the request credentials or an
+// error if the request does not include valid credentials.
+func (a *Auth) Authenticate(r *http.Request) (*Principal, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	if uid, pwd, ok := r.BasicAuth(); ok {
+		if u, ok := a.users[uid]; ok && u.password != "" && verify(u.password, pwd) {
+			return &Principal{Name: uid, endpoints: u.endpoints}, nil
+		}
+
+		return nil, fmt.Errorf("invalid credentials for user %v", uid)
+	}
+
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		bearer := strings.TrimSpace(header[7:])
+		hash := sha256.Sum256([]byte(bearer))
+
+		for _, t := range a.tokens {
+			if subtle.ConstantTimeCompare(hash[:], t.hash) == 1 {
+				return &Principal{Name: "token:" + t.name, endpoints: t.endpoints}, nil
+			}
+		}
+
+		if a.jwt != nil && strings.Count(bearer, ".") == 2 {
+			subject, err := a.jwt.verify(bearer)
+			if err != nil {
+				return nil, err
+			}
+
+			endpoints := a.jwt.endpoints
+			if list, ok := a.jwt.subjects[subject]; ok {
+				endpoints = list
+			}
+
+			return &Principal{Name: "jwt:" + subject, endpoints: endpoints}, nil
+		}
+
+		return nil, fmt.Errorf("invalid bearer token")
+	}
+
+	return nil, fmt.Errorf("missing credentials")
+}
+
+// Allow returns an error if the authenticated principal is not permitted to use the endpoint.
+func (a *Auth) Allow(p *Principal, path string) error {
+	if a == nil {
+		return nil
+	} else if p == nil {
+		return fmt.Errorf("%v not permitted for unauthenticated requests", path)
+	}
+
+	endpoints := p.endpoints
+	if endpoints == nil {
+		return nil
+	}
+
+	for _, e := range endpoints {
+		if e == "*" || path == e || strings.HasPrefix(path, strings.TrimSuffix(e, "/")+"/") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%v not permitted for %v", path, p.Name)
+}
+
+// Challenge sets the WWW-Authenticate header for a 401 response.
+func (a *Auth) Challenge(w http.ResponseWriter) {
+	if a != nil {
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="%v", charset="UTF-8"`, REALM))
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v"`, REALM))
+	}
+}
+
+func htpasswd(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	users := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if uid, pwd, ok := strings.Cut(line, ":"); ok {
+			users[uid] = pwd
+		}
+	}
+
+	return users, scanner.Err()
+}
+
+func verify(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected := base64.StdEncoding.EncodeToString(sum[:])
+
+		return subtle.ConstantTimeCompare([]byte(hash[5:]), []byte(expected)) == 1
+
+	default:
+		warnf("unsupported password hash (only bcrypt and SHA are supported)")
+		return false
+	}
+}
+
+func relative(file, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(file), path)
+}
+
+func infof(format string, args ...any) {
+	f := fmt.Sprintf("%-10v %v", "AUTH", format)
+
+	log.Infof(f, args...)
+}
+
+func warnf(format string, args ...any) {
+	f := fmt.Sprintf("%-10v %v", "AUTH", format)
+
+	log.Warnf(f, args...)
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const TOML = `
+[[user]]
+name = "admin"
+password = "%v"
+
+[[user]]
+name = "reader"
+password = "{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M="
+endpoints = [ "/udp/broadcast" ]
+
+[[token]]
+name = "portal"
+token = "sha256:%x"
+endpoints = [ "/udp/send" ]
+
+[jwt]
+jwks = "jwks.json"
+issuer = "https://idp.example.com"
+audience = "uhppoted-tunnel"
+endpoints = [ "/udp/send" ]
+
+[[jwt.subject]]
+name = "operator"
+endpoints = [ "/udp/broadcast" ]
+`
+
+func TestAuth(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	auth := setup(t, key)
+
+	tests := []struct {
+		header   string
+		user     string
+		path     string
+		rejected bool
+		denied   bool
+	}{
+		{header: basic("admin", "qwerty"), user: "admin", path: "/udp/send"},
+		{header: basic("admin", "uiop"), rejected: true},
+		{header: basic("reader", "test"), user: "reader", path: "/udp/broadcast"},
+		{header: basic("reader", "test"), user: "reader", path: "/udp/send", denied: true},
+		{header: "Bearer 0123456789abcdef", user: "token:portal", path: "/udp/send"},
+		{header: "Bearer 0123456789abcdeg", rejected: true},
+		{header: "Bearer " + jwt(t, key, "admin", time.Hour), user: "jwt:admin", path: "/udp/send"},
+		{header: "Bearer " + jwt(t, key, "admin", time.Hour), user: "jwt:admin", path: "/udp/broadcast", denied: true},
+		{header: "Bearer " + jwt(t, key, "reader", time.Hour), user: "jwt:reader", path: "/udp/broadcast", denied: true},
+		{header: "Bearer " + jwt(t, key, "operator", time.Hour), user: "jwt:operator", path: "/udp/broadcast"},
+		{header: "Bearer " + jwt(t, key, "operator", time.Hour), user: "jwt:operator", path: "/udp/send", denied: true},
+		{header: "Bearer " + jwt(t, key, "someone", time.Hour), user: "jwt:someone", path: "/udp/broadcast", denied: true},
+		{header: "Bearer " + jwt(t, key, "someone", -time.Hour), rejected: true},
+		{header: "", rejected: true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/udp/send", nil)
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+
+		principal, err := auth.Authenticate(r)
+		if test.rejected {
+			if err == nil {
+				t.Errorf("%v: expected authentication error", test.header)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected authentication error (%v)", test.header, err)
+		} else if principal.Name != test.user {
+			t.Errorf("%v: incorrect user - expected:%v, got:%v", test.header, test.user, principal.Name)
+		} else if err := auth.Allow(principal, test.path); test.denied && err == nil {
+			t.Errorf("%v: expected %v to be denied", principal.Name, test.path)
+		} else if !test.denied && err != nil {
+			t.Errorf("%v: unexpected error (%v)", principal.Name, err)
+		}
+	}
+}
+
+func TestLoadWithInvalidNames(t *testing.T) {
+	tests := []string{
+		`
+[[token]]
+name = "portal"
+token = "0123456789abcdef"
+
+[[token]]
+name = "portal"
+token = "fedcba9876543210"
+endpoints = [ "/udp/broadcast" ]
+`,
+		`
+[[token]]
+token = "0123456789abcdef"
+
+[[token]]
+token = "fedcba9876543210"
+endpoints = [ "/udp/broadcast" ]
+`,
+		`
+[[user]]
+name = "token:portal"
+password = "{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M="
+`,
+		`
+[[user]]
+name = "jwt:admin"
+password = "{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M="
+`,
+	}
+
+	for _, v := range tests {
+		file := filepath.Join(t.TempDir(), "auth.toml")
+		if err := os.WriteFile(file, []byte(v), 0600); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if _, err := Load(file); err == nil {
+			t.Errorf("expected error loading %v", v)
+		}
+	}
+}
+
+func TestAllowWithoutPrincipal(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	auth := setup(t, key)
+
+	if err := auth.Allow(nil, "/udp/send"); err == nil {
+		t.Errorf("expected unauthenticated request to be denied")
+	}
+}
+
+func setup(t *testing.T, key *ecdsa.PrivateKey) *Auth {
+	dir := t.TempDir()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("qwerty"), bcrypt.MinCost)
+	token := sha256.Sum256([]byte("0123456789abcdef"))
+
+	jwks := fmt.Sprintf(`{ "keys": [{ "kid":"k1", "kty":"EC", "crv":"P-256", "x":"%v", "y":"%v" }] }`,
+		base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))))
+
+	if err := os.WriteFile(filepath.Join(dir, "auth.toml"), []byte(fmt.Sprintf(TOML, string(hash), token)), 0600); err != nil {
+		t.Fatalf("%v", err)
+	} else if err := os.WriteFile(filepath.Join(dir, "jwks.json"), []byte(jwks), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	auth, err := Load(filepath.Join(dir, "auth.toml"))
+	if err != nil {
+		t.Fatalf("error loading auth file (%v)", err)
+	}
+
+	return auth
+}
+
+func basic(uid, pwd string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(uid+":"+pwd))
+}
+
+func jwt(t *testing.T, key *ecdsa.PrivateKey, subject string, expires time.Duration) string {
+	header, _ := json.Marshal(map[string]any{"alg": "ES256", "kid": "k1", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"sub": subject,
+		"iss": "https://idp.example.com",
+		"aud": []string{"uhppoted-tunnel"},
+		"exp": time.Now().Add(expires).Unix(),
+	})
+
+	data := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(data))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	return data + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
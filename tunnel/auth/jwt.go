@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// verifier validates JWT bearer tokens signed with RS256/384/512, ES256/384 or EdDSA using the
+// public keys in a JWKS file.
+type verifier struct {
+	keys      map[string]crypto.PublicKey
+	issuer    string
+	audience  string
+	endpoints []string
+	subjects  map[string][]string
+}
+
+const LEEWAY = 60 * time.Second
+
+func newVerifier(file, issuer, audience string, endpoints []string, subjects map[string][]string) (*verifier, error) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := struct {
+		Keys []struct {
+			KID string `json:"kid"`
+			KTY string `json:"kty"`
+			CRV string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(bytes, &jwks); err != nil {
+		return nil, fmt.Errorf("invalid JWKS file %v (%v)", file, err)
+	}
+
+	v := verifier{
+		keys:      map[string]crypto.PublicKey{},
+		issuer:    issuer,
+		audience:  audience,
+		endpoints: endpoints,
+		subjects:  subjects,
+	}
+
+	for _, k := range jwks.Keys {
+		switch k.KTY {
+		case "RSA":
+			n, err1 := decode(k.N)
+			e, err2 := decode(k.E)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid JWKS RSA key '%v'", k.KID)
+			}
+
+			v.keys[k.KID] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+
+		case "EC":
+			var curve elliptic.Curve
+			switch k.CRV {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				return nil, fmt.Errorf("unsupported JWKS EC curve '%v'", k.CRV)
+			}
+
+			x, err1 := decode(k.X)
+			y, err2 := decode(k.Y)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid JWKS EC key '%v'", k.KID)
+			}
+
+			v.keys[k.KID] = &ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+
+		case "OKP":
+			if x, err := decode(k.X); err != nil || k.CRV != "Ed25519" || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("invalid JWKS OKP key '%v'", k.KID)
+			} else {
+				v.keys[k.KID] = ed25519.PublicKey(x)
+			}
+
+		default:
+			return nil, fmt.Errorf("unsupported JWKS key type '%v'", k.KTY)
+		}
+	}
+
+	if len(v.keys) == 0 {
+		return nil, fmt.Errorf("no keys in JWKS file %v", file)
+	}
+
+	return &v, nil
+}
+
+// verify checks the token signature, expiry, issuer and audience and returns the token subject.
+func (v *verifier) verify(jwt string) (string, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid JWT")
+	}
+
+	header := struct {
+		ALG string `json:"alg"`
+		KID string `json:"kid"`
+	}{}
+
+	claims := struct {
+		Subject   string          `json:"sub"`
+		Issuer    string          `json:"iss"`
+		Audience  json.RawMessage `json:"aud"`
+		ExpiresAt *int64          `json:"exp"`
+		NotBefore *int64          `json:"nbf"`
+	}{}
+
+	if b, err := decode(parts[0]); err != nil {
+		return "", fmt.Errorf("invalid JWT header")
+	} else if err := json.Unmarshal(b, &header); err != nil {
+		return "", fmt.Errorf("invalid JWT header")
+	}
+
+	key, ok := v.keys[header.KID]
+	if !ok && header.KID == "" && len(v.keys) == 1 {
+		for _, k := range v.keys {
+			key = k
+		}
+	} else if !ok {
+		return "", fmt.Errorf("unknown JWT key '%v'", header.KID)
+	}
+
+	signature, err := decode(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid JWT signature")
+	}
+
+	if err := verifySignature(header.ALG, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return "", err
+	}
+
+	if b, err := decode(parts[1]); err != nil {
+		return "", fmt.Errorf("invalid JWT claims")
+	} else if err := json.Unmarshal(b, &claims); err != nil {
+		return "", fmt.Errorf("invalid JWT claims")
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == nil {
+		return "", fmt.Errorf("JWT missing 'exp' claim")
+	} else if now.After(time.Unix(*claims.ExpiresAt, 0).Add(LEEWAY)) {
+		return "", fmt.Errorf("JWT expired")
+	}
+
+	if claims.NotBefore != nil && now.Add(LEEWAY).Before(time.Unix(*claims.NotBefore, 0)) {
+		return "", fmt.Errorf("JWT not yet valid")
+	}
+
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return "", fmt.Errorf("invalid JWT issuer '%v'", claims.Issuer)
+	}
+
+	if v.audience != "" && !audience(claims.Audience, v.audience) {
+		return "", fmt.Errorf("invalid JWT audience")
+	}
+
+	return claims.Subject, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, data, signature []byte) error {
+	hash := func(h crypto.Hash) []byte {
+		d := h.New()
+		d.Write(data)
+		return d.Sum(nil)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		var h crypto.Hash
+		switch alg {
+		case "RS256":
+			h = crypto.SHA256
+		case "RS384":
+			h = crypto.SHA384
+		case "RS512":
+			h = crypto.SHA512
+		default:
+			return fmt.Errorf("unsupported JWT algorithm '%v' for RSA key", alg)
+		}
+
+		if err := rsa.VerifyPKCS1v15(k, h, hash(h), signature); err != nil {
+			return fmt.Errorf("invalid JWT signature")
+		}
+
+	case *ecdsa.PublicKey:
+		var h crypto.Hash
+		switch {
+		case alg == "ES256" && k.Curve == elliptic.P256():
+			h = crypto.SHA256
+		case alg == "ES384" && k.Curve == elliptic.P384():
+			h = crypto.SHA384
+		default:
+			return fmt.Errorf("unsupported JWT algorithm '%v' for EC key", alg)
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid JWT signature")
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, hash(h), r, s) {
+			return fmt.Errorf("invalid JWT signature")
+		}
+
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return fmt.Errorf("unsupported JWT algorithm '%v' for Ed25519 key", alg)
+		}
+
+		if !ed25519.Verify(k, data, signature) {
+			return fmt.Errorf("invalid JWT signature")
+		}
+
+	default:
+		return fmt.Errorf("unsupported JWT key")
+	}
+
+	return nil
+}
+
+func audience(claim json.RawMessage, expected string) bool {
+	var s string
+	var list []string
+
+	if err := json.Unmarshal(claim, &s); err == nil {
+		return s == expected
+	}
+
+	if err := json.Unmarshal(claim, &list); err == nil {
+		for _, v := range list {
+			if v == expected {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+)
+
+// stub is the OUT connector wrapped by the caches under test. A request is answered with a get-device
+// reply from each of the devices or, if there are no devices, by echoing the request. The replies are
+// held until the hold channel is closed (if not nil).
+type stub struct {
+	router   *router.Switch
+	requests chan uint32
+	devices  []uint32
+	hold     chan struct{}
+	ready    chan struct{}
+	sync.WaitGroup
+}
+
+type received struct {
+	replies map[uint32][]uint32
+	sync.Mutex
+}
+
+func newStub(hold chan struct{}, devices ...uint32) *stub {
+	return &stub{
+		requests: make(chan uint32, 16),
+		devices:  devices,
+		hold:     hold,
+		ready:    make(chan struct{}),
+	}
+}
+
+func (s *stub) Close() {
+}
+
+func (s *stub) Run(r *router.Switch) error {
+	s.router = r
+	close(s.ready)
+
+	return nil
+}
+
+func (s *stub) Send(id uint32, message []byte) {
+	s.requests <- id
+
+	s.Add(1)
+	go func() {
+		defer s.Done()
+
+		if s.hold != nil {
+			<-s.hold
+		}
+
+		if len(s.devices) == 0 {
+			s.router.Received(id, message, nil)
+		}
+
+		for _, controller := range s.devices {
+			s.router.Received(id, reply(0x94, controller), nil)
+		}
+	}()
+}
+
+func (r *received) count(id uint32) int {
+	r.Lock()
+	defer r.Unlock()
+
+	return len(r.replies[id])
+}
+
+// setup runs the cache under test with a router that records the controller serial number of each
+// reply relayed to the IN connector.
+func setup(t *testing.T, c tunnel.Conn, out *stub) *received {
+	r := received{
+		replies: map[uint32][]uint32{},
+	}
+
+	sw := router.NewSwitch(func(id uint32, message []byte) {
+		r.Lock()
+		defer r.Unlock()
+
+		r.replies[id] = append(r.replies[id], binary.LittleEndian.Uint32(message[4:8]))
+	})
+
+	go c.Run(&sw)
+
+	select {
+	case <-out.ready:
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for connector")
+	}
+
+	return &r
+}
+
+func request(function byte, controller uint32) []byte {
+	message := make([]byte, 64)
+	message[0] = 0x17
+	message[1] = function
+	binary.LittleEndian.PutUint32(message[4:8], controller)
+
+	return message
+}
+
+func reply(function byte, controller uint32) []byte {
+	return request(function, controller)
+}
+
+func wait(t *testing.T, r *received, id uint32, expected int) {
+	deadline := time.Now().Add(time.Second)
+
+	for r.count(id) < expected && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := r.count(id); n != expected {
+		t.Errorf("request %v: incorrect number of replies - expected:%v, got:%v", id, expected, n)
+	}
+}
+
+func forwarded(out *stub) []uint32 {
+	list := []uint32{}
+
+	for {
+		select {
+		case id := <-out.requests:
+			list = append(list, id)
+		default:
+			return list
+		}
+	}
+}
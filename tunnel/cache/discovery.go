@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"encoding/binary"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// discovery wraps an OUT connector and answers broadcast get-device requests from the replies to a
+// recent get-device broadcast. The cached replies are refreshed in the background once they are older
+// than half the TTL and controllers that have not replied within the TTL are dropped from the cache.
+// Get-device requests addressed to a specific controller bypass the cache and set-address and
+// restore-default-parameters requests invalidate the cached reply for the controller.
+type discovery struct {
+	conn.Conn
+	out       tunnel.Conn
+	ttl       time.Duration
+	router    *router.Switch
+	devices   map[uint32]device
+	requests  map[uint32]broadcast
+	refreshed time.Time
+	sync.Mutex
+}
+
+type device struct {
+	reply []byte
+	seen  time.Time
+}
+
+type broadcast struct {
+	sent     time.Time
+	internal bool
+}
+
+// REPLY_WINDOW is the time after a get-device broadcast during which replies are added to the cache.
+const REPLY_WINDOW = 60 * time.Second
+
+// NewDiscovery wraps an OUT connector with a cache for broadcast get-device requests.
+func NewDiscovery(out tunnel.Conn, ttl time.Duration) *discovery {
+	d := discovery{
+		Conn: conn.Conn{
+			Tag: "CACHE",
+		},
+		out:      out,
+		ttl:      ttl,
+		devices:  map[uint32]device{},
+		requests: map[uint32]broadcast{},
+	}
+
+	d.Infof("discovery cache TTL %v", ttl)
+
+	return &d
+}
+
+func (d *discovery) Close() {
+	d.out.Close()
+}
+
+func (d *discovery) Run(router *router.Switch) error {
+	d.Lock()
+	d.router = router
+	d.Unlock()
+
+	filtered := router.Filter(d.received)
+
+	return d.out.Run(&filtered)
+}
+
+func (d *discovery) Send(id uint32, message []byte) {
+	controller, function, ok := decode(message)
+
+	switch {
+	case ok && function == 0x94 && controller == 0:
+		d.discover(id, message)
+
+	case ok && (function == 0x96 || function == 0xc8):
+		d.invalidate(controller)
+		d.out.Send(id, message)
+
+	default:
+		d.out.Send(id, message)
+	}
+}
+
+// discover answers a broadcast get-device request from the cache if the cache is current, otherwise
+// the request is forwarded to the wrapped connector and the replies are cached.
+func (d *discovery) discover(id uint32, message []byte) {
+	now := time.Now()
+
+	d.Lock()
+
+	d.sweep(now)
+
+	replies := d.lookup(now)
+	if replies == nil || d.router == nil {
+		d.requests[id] = broadcast{sent: now}
+		d.refreshed = now
+		d.Unlock()
+
+		d.Debugf("get-device %v  cache miss", id)
+		d.out.Send(id, message)
+
+		return
+	}
+
+	refresh := uint32(0)
+	if now.Sub(d.refreshed) > d.ttl/2 {
+		refresh = protocol.NextID()
+		d.requests[refresh] = broadcast{sent: now, internal: true}
+		d.refreshed = now
+	}
+
+	router := d.router
+
+	d.Unlock()
+
+	d.Debugf("get-device %v  %v cached replies", id, len(replies))
+	for _, reply := range replies {
+		router.Received(id, reply, nil)
+	}
+
+	if refresh != 0 {
+		d.Debugf("get-device %v  refreshing", refresh)
+		go d.out.Send(refresh, slices.Clone(message))
+	}
+}
+
+// received caches the replies to get-device broadcasts. The replies to background refreshes are
+// discarded after they have been cached because there is no client waiting for them.
+func (d *discovery) received(id uint32, message []byte) []byte {
+	controller, function, ok := decode(message)
+	if !ok || function != 0x94 || controller == 0 {
+		return message
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if rq, ok := d.requests[id]; ok {
+		d.devices[controller] = device{
+			reply: slices.Clone(message),
+			seen:  time.Now(),
+		}
+
+		if rq.internal {
+			return nil
+		}
+	}
+
+	return message
+}
+
+func (d *discovery) invalidate(controller uint32) {
+	d.Lock()
+	defer d.Unlock()
+
+	if controller == 0 {
+		clear(d.devices)
+	} else {
+		delete(d.devices, controller)
+	}
+}
+
+// lookup returns the cached replies for the controllers that have replied within the TTL, or nil if
+// the cache is empty or has not been refreshed within the TTL.
+func (d *discovery) lookup(now time.Time) [][]byte {
+	if now.Sub(d.refreshed) > d.ttl {
+		return nil
+	}
+
+	var replies [][]byte
+	for _, v := range d.devices {
+		if now.Sub(v.seen) <= d.ttl {
+			replies = append(replies, v.reply)
+		}
+	}
+
+	return replies
+}
+
+func (d *discovery) sweep(now time.Time) {
+	for k, v := range d.requests {
+		if now.Sub(v.sent) > REPLY_WINDOW {
+			delete(d.requests, k)
+		}
+	}
+
+	for k, v := range d.devices {
+		if now.Sub(v.seen) > d.ttl {
+			delete(d.devices, k)
+		}
+	}
+}
+
+// decode returns the controller serial number and function code of a UHPPOTE request or reply.
+func decode(message []byte) (uint32, byte, bool) {
+	if len(message) != 64 || message[0] != 0x17 {
+		return 0, 0, false
+	}
+
+	return binary.LittleEndian.Uint32(message[4:8]), message[1], true
+}
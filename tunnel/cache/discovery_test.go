@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiscoveryCachesBroadcastReplies(t *testing.T) {
+	out := newStub(nil, 405419896, 303986753)
+	d := NewDiscovery(out, time.Minute)
+	r := setup(t, d, out)
+
+	d.Send(1001, request(0x94, 0))
+	wait(t, r, 1001, 2)
+
+	d.Send(1002, request(0x94, 0))
+	wait(t, r, 1002, 2)
+
+	if list := forwarded(out); len(list) != 1 || list[0] != 1001 {
+		t.Errorf("incorrect forwarded requests - expected:%v, got:%v", []uint32{1001}, list)
+	}
+}
+
+func TestDiscoveryBypassesDirectedRequests(t *testing.T) {
+	out := newStub(nil, 405419896)
+	d := NewDiscovery(out, time.Minute)
+	r := setup(t, d, out)
+
+	d.Send(2001, request(0x94, 0))
+	wait(t, r, 2001, 1)
+
+	d.Send(2002, request(0x94, 405419896))
+	wait(t, r, 2002, 1)
+
+	if list := forwarded(out); len(list) != 2 {
+		t.Errorf("incorrect forwarded requests - expected:%v, got:%v", 2, list)
+	}
+}
+
+func TestDiscoveryRefreshesInBackground(t *testing.T) {
+	out := newStub(nil, 405419896)
+	d := NewDiscovery(out, time.Minute)
+	r := setup(t, d, out)
+
+	d.Send(3001, request(0x94, 0))
+	wait(t, r, 3001, 1)
+	forwarded(out)
+
+	d.Lock()
+	d.refreshed = d.refreshed.Add(-40 * time.Second)
+	d.Unlock()
+
+	d.Send(3002, request(0x94, 0))
+	wait(t, r, 3002, 1)
+
+	select {
+	case id := <-out.requests:
+		if id == 3002 {
+			t.Errorf("request forwarded instead of answered from cache")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+
+		if n := r.count(id); n != 0 {
+			t.Errorf("background refresh replies relayed to client (%v)", n)
+		}
+
+	case <-time.After(time.Second):
+		t.Errorf("cache not refreshed")
+	}
+}
+
+func TestDiscoveryExpiry(t *testing.T) {
+	out := newStub(nil, 405419896)
+	d := NewDiscovery(out, time.Minute)
+	r := setup(t, d, out)
+
+	d.Send(4001, request(0x94, 0))
+	wait(t, r, 4001, 1)
+	forwarded(out)
+
+	d.Lock()
+	d.refreshed = d.refreshed.Add(-2 * time.Minute)
+	d.Unlock()
+
+	d.Send(4002, request(0x94, 0))
+	wait(t, r, 4002, 1)
+
+	if list := forwarded(out); len(list) != 1 || list[0] != 4002 {
+		t.Errorf("expired cache not bypassed - expected:%v, got:%v", []uint32{4002}, list)
+	}
+}
+
+func TestDiscoveryInvalidatedBySetAddress(t *testing.T) {
+	out := newStub(nil, 405419896, 303986753)
+	d := NewDiscovery(out, time.Minute)
+	r := setup(t, d, out)
+
+	d.Send(5001, request(0x94, 0))
+	wait(t, r, 5001, 2)
+
+	d.Send(5002, request(0x96, 405419896))
+	wait(t, r, 5002, 2)
+
+	d.Lock()
+	replies := d.lookup(time.Now())
+	d.Unlock()
+
+	if len(replies) != 1 {
+		t.Errorf("incorrect cached replies after set-address - expected:%v, got:%v", 1, len(replies))
+	}
+}
@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// responses wraps an OUT connector with a read-through cache for the replies to the configured
+// read-only requests. The cache is keyed on the request bytes and identical requests that are received
+// while a request is in flight are answered from the reply to the in-flight request, rather than being
+// sent to the controller again. Any other request to a controller removes the cached replies for that
+// controller, so that e.g. a get-time following a set-time is not answered with the previous time.
+type responses struct {
+	conn.Conn
+	out     tunnel.Conn
+	ttls    map[byte]time.Duration
+	timeout time.Duration
+	router  *router.Switch
+	entries map[string]*entry
+	pending map[uint32]*entry
+	sync.Mutex
+}
+
+type entry struct {
+	key     string
+	id      uint32
+	sent    time.Time
+	reply   []byte
+	expires time.Time
+	waiting []uint32
+}
+
+// NewResponses wraps an OUT connector with a response cache for the function codes in ttls. The timeout
+// is the maximum time to wait for the reply to an in-flight request before an identical request is
+// sent to the controller.
+func NewResponses(out tunnel.Conn, ttls map[byte]time.Duration, timeout time.Duration) *responses {
+	r := responses{
+		Conn: conn.Conn{
+			Tag: "CACHE",
+		},
+		out:     out,
+		ttls:    ttls,
+		timeout: timeout,
+		entries: map[string]*entry{},
+		pending: map[uint32]*entry{},
+	}
+
+	list := []string{}
+	for _, code := range slices.Sorted(maps.Keys(ttls)) {
+		list = append(list, fmt.Sprintf("%v:%v", protocol.FunctionName(code), ttls[code]))
+	}
+
+	r.Infof("response cache %v", strings.Join(list, ", "))
+
+	return &r
+}
+
+// ParseTTLs parses a comma separated list of function:TTL pairs e.g. get-status:2s,get-time:5s. The
+// functions must be idempotent (read-only) functions.
+func ParseTTLs(spec string) (map[byte]time.Duration, error) {
+	ttls := map[byte]time.Duration{}
+
+	for _, v := range strings.Split(spec, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		name, ttl, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid response cache TTL '%v' (expected function:TTL)", v)
+		}
+
+		code, ok := protocol.FunctionCode(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("invalid response cache function '%v'", name)
+		} else if !protocol.IsIdempotent(code) {
+			return nil, fmt.Errorf("response cache function '%v' is not a read-only function", name)
+		}
+
+		if d, err := time.ParseDuration(strings.TrimSpace(ttl)); err != nil {
+			return nil, fmt.Errorf("invalid response cache TTL '%v' (%v)", v, err)
+		} else if d <= 0 {
+			return nil, fmt.Errorf("invalid response cache TTL '%v'", v)
+		} else {
+			ttls[code] = d
+		}
+	}
+
+	return ttls, nil
+}
+
+func (r *responses) Close() {
+	r.out.Close()
+}
+
+func (r *responses) Run(router *router.Switch) error {
+	r.Lock()
+	r.router = router
+	r.Unlock()
+
+	filtered := router.Filter(r.received)
+
+	return r.out.Run(&filtered)
+}
+
+func (r *responses) Send(id uint32, message []byte) {
+	controller, function, ok := decode(message)
+
+	switch {
+	case !ok || controller == 0:
+		r.out.Send(id, message)
+
+	case r.ttls[function] > 0:
+		r.lookup(id, message)
+
+	default:
+		r.invalidate(controller)
+		r.out.Send(id, message)
+	}
+}
+
+// lookup answers a request from the cache if there is a current cached reply, waits for the reply to an
+// identical in-flight request or otherwise forwards the request to the wrapped connector.
+func (r *responses) lookup(id uint32, message []byte) {
+	now := time.Now()
+	key := string(message)
+
+	r.Lock()
+
+	r.sweep(now)
+
+	if e, ok := r.entries[key]; ok && r.router != nil {
+		if e.reply != nil && now.Before(e.expires) {
+			reply := e.reply
+			router := r.router
+			r.Unlock()
+
+			r.Debugf("request %v  cached reply", id)
+			router.Received(id, reply, nil)
+
+			return
+		}
+
+		if e.reply == nil && now.Sub(e.sent) < r.timeout {
+			e.waiting = append(e.waiting, id)
+			r.Unlock()
+
+			r.Debugf("request %v  waiting for request %v", id, e.id)
+
+			return
+		}
+	}
+
+	e := entry{
+		key:  key,
+		id:   id,
+		sent: now,
+	}
+
+	r.entries[key] = &e
+	r.pending[id] = &e
+	r.Unlock()
+
+	r.out.Send(id, message)
+}
+
+// received relays the reply to a forwarded request to the requests waiting for the same reply and
+// caches the reply unless the entry has been invalidated or replaced while the request was in flight.
+func (r *responses) received(id uint32, message []byte) []byte {
+	r.Lock()
+
+	e, ok := r.pending[id]
+	if !ok {
+		r.Unlock()
+		return message
+	}
+
+	delete(r.pending, id)
+
+	reply := slices.Clone(message)
+	waiting := e.waiting
+	e.waiting = nil
+	router := r.router
+
+	if r.entries[e.key] == e {
+		_, function, _ := decode([]byte(e.key))
+
+		e.reply = reply
+		e.expires = time.Now().Add(r.ttls[function])
+	}
+
+	r.Unlock()
+
+	for _, w := range waiting {
+		router.Received(w, reply, nil)
+	}
+
+	return message
+}
+
+// invalidate removes the cached replies for a controller. In-flight requests are removed from the cache
+// so that the reply (which may predate the invalidating request) is relayed to the waiting requests but
+// is not cached.
+func (r *responses) invalidate(controller uint32) {
+	r.Lock()
+	defer r.Unlock()
+
+	for k := range r.entries {
+		if c, _, _ := decode([]byte(k)); c == controller {
+			delete(r.entries, k)
+		}
+	}
+}
+
+func (r *responses) sweep(now time.Time) {
+	for k, e := range r.entries {
+		if e.reply != nil && now.After(e.expires) {
+			delete(r.entries, k)
+		} else if e.reply == nil && now.Sub(e.sent) > r.timeout {
+			delete(r.entries, k)
+		}
+	}
+
+	for id, e := range r.pending {
+		if now.Sub(e.sent) > r.timeout {
+			delete(r.pending, id)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTTLs(t *testing.T) {
+	expected := map[byte]time.Duration{
+		0x20: 2 * time.Second,
+		0x32: 5 * time.Second,
+	}
+
+	ttls, err := ParseTTLs("get-status:2s, get-time:5s")
+	if err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	if !reflect.DeepEqual(ttls, expected) {
+		t.Errorf("incorrect TTLs - expected:%v, got:%v", expected, ttls)
+	}
+}
+
+func TestParseTTLsWithInvalidFunction(t *testing.T) {
+	tests := []string{
+		"get-status",
+		"get-stuff:2s",
+		"open-door:2s",
+		"get-status:0s",
+		"get-status:2",
+	}
+
+	for _, spec := range tests {
+		if _, err := ParseTTLs(spec); err == nil {
+			t.Errorf("expected error for '%v'", spec)
+		}
+	}
+}
+
+func TestResponsesCachesReplies(t *testing.T) {
+	out := newStub(nil)
+	c := NewResponses(out, map[byte]time.Duration{0x20: time.Minute}, time.Second)
+	r := setup(t, c, out)
+
+	c.Send(1001, request(0x20, 405419896))
+	wait(t, r, 1001, 1)
+
+	c.Send(1002, request(0x20, 405419896))
+	wait(t, r, 1002, 1)
+
+	c.Send(1003, request(0x20, 303986753))
+	wait(t, r, 1003, 1)
+
+	if list := forwarded(out); !reflect.DeepEqual(list, []uint32{1001, 1003}) {
+		t.Errorf("incorrect forwarded requests - expected:%v, got:%v", []uint32{1001, 1003}, list)
+	}
+}
+
+func TestResponsesCoalescesInFlightRequests(t *testing.T) {
+	hold := make(chan struct{})
+	out := newStub(hold)
+	c := NewResponses(out, map[byte]time.Duration{0x20: time.Minute}, time.Second)
+	r := setup(t, c, out)
+
+	c.Send(2001, request(0x20, 405419896))
+	c.Send(2002, request(0x20, 405419896))
+	c.Send(2003, request(0x20, 405419896))
+
+	close(hold)
+	out.Wait()
+
+	wait(t, r, 2001, 1)
+	wait(t, r, 2002, 1)
+	wait(t, r, 2003, 1)
+
+	if list := forwarded(out); !reflect.DeepEqual(list, []uint32{2001}) {
+		t.Errorf("incorrect forwarded requests - expected:%v, got:%v", []uint32{2001}, list)
+	}
+}
+
+func TestResponsesIgnoresUncachedFunctions(t *testing.T) {
+	out := newStub(nil)
+	c := NewResponses(out, map[byte]time.Duration{0x20: time.Minute}, time.Second)
+	r := setup(t, c, out)
+
+	c.Send(3001, request(0x32, 405419896))
+	wait(t, r, 3001, 1)
+
+	c.Send(3002, request(0x32, 405419896))
+	wait(t, r, 3002, 1)
+
+	if list := forwarded(out); len(list) != 2 {
+		t.Errorf("incorrect forwarded requests - expected:%v, got:%v", 2, list)
+	}
+}
+
+func TestResponsesInvalidatedByOtherRequests(t *testing.T) {
+	out := newStub(nil)
+	c := NewResponses(out, map[byte]time.Duration{0x32: time.Minute}, time.Second)
+	r := setup(t, c, out)
+
+	c.Send(4001, request(0x32, 405419896))
+	wait(t, r, 4001, 1)
+
+	c.Send(4002, request(0x30, 405419896))
+	wait(t, r, 4002, 1)
+
+	c.Send(4003, request(0x32, 405419896))
+	wait(t, r, 4003, 1)
+
+	if list := forwarded(out); !reflect.DeepEqual(list, []uint32{4001, 4002, 4003}) {
+		t.Errorf("incorrect forwarded requests - expected:%v, got:%v", []uint32{4001, 4002, 4003}, list)
+	}
+}
+
+func TestResponsesInvalidatesInFlightRequests(t *testing.T) {
+	hold := make(chan struct{})
+	out := newStub(hold)
+	c := NewResponses(out, map[byte]time.Duration{0x32: time.Minute}, time.Second)
+	r := setup(t, c, out)
+
+	c.Send(5001, request(0x32, 405419896))
+	c.Send(5002, request(0x32, 405419896))
+	c.Send(5003, request(0x30, 405419896))
+
+	close(hold)
+	out.Wait()
+
+	wait(t, r, 5001, 1)
+	wait(t, r, 5002, 1)
+	wait(t, r, 5003, 1)
+
+	c.Send(5004, request(0x32, 405419896))
+	wait(t, r, 5004, 1)
+
+	if list := forwarded(out); !reflect.DeepEqual(list, []uint32{5001, 5003, 5004}) {
+		t.Errorf("incorrect forwarded requests - expected:%v, got:%v", []uint32{5001, 5003, 5004}, list)
+	}
+}
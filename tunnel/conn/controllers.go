@@ -0,0 +1,58 @@
+package conn
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+)
+
+// Controller holds the settings from the TOML [controllers] table for a controller i.e. the (optional)
+// address, (optional) request timeout override and (optional) timezone.
+type Controller struct {
+	Address  string
+	Timeout  time.Duration
+	Location *time.Location
+}
+
+const MAX_UDP_RETRIES = 8
+
+// Attempts returns the time to wait for a reply to each attempt at sending a UDP request. Idempotent
+// requests are retried up to 'retries' times, with the wait doubling for each attempt and the total wait
+// equal to the timeout. All other requests are sent once.
+func Attempts(message []byte, retries int, timeout time.Duration) []time.Duration {
+	if retries <= 0 || len(message) < 2 || !protocol.IsIdempotent(message[1]) {
+		return []time.Duration{timeout}
+	}
+
+	if retries > MAX_UDP_RETRIES {
+		retries = MAX_UDP_RETRIES
+	}
+
+	attempts := make([]time.Duration, retries+1)
+	unit := timeout / time.Duration(1<<len(attempts)-1)
+	remaining := timeout
+
+	for i := range attempts[:retries] {
+		attempts[i] = unit << i
+		remaining -= attempts[i]
+	}
+
+	attempts[retries] = remaining
+
+	return attempts
+}
+
+// Timeout returns the request timeout for the controller addressed by a request, or the default timeout
+// if the controller does not have a timeout override.
+func Timeout(message []byte, controllers map[uint32]Controller, timeout time.Duration) time.Duration {
+	if len(message) >= 8 {
+		controller := binary.LittleEndian.Uint32(message[4:8])
+
+		if v, ok := controllers[controller]; ok && v.Timeout > 0 {
+			return v.Timeout
+		}
+	}
+
+	return timeout
+}
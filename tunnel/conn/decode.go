@@ -0,0 +1,157 @@
+package conn
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	codec "github.com/uhppoted/uhppote-core/encoding/UTO311-L0x"
+	"github.com/uhppoted/uhppote-core/messages"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+)
+
+// Kind identifies a UHPPOTE message as a request, reply or event for decoding.
+type Kind int
+
+const (
+	Request Kind = iota + 1
+	Reply
+	Event
+)
+
+func (k Kind) String() string {
+	return [...]string{"?", "request", "reply", "event"}[k]
+}
+
+// DumpFormat selects the format for the messages logged with DumpRequestf, DumpReplyf and DumpEventf.
+type DumpFormat int
+
+const (
+	Hex DumpFormat = iota
+	Decoded
+	Both
+)
+
+var dumpFormat = Hex
+
+// SetDumpFormat sets the debug log format for UHPPOTE messages (hex, decoded or both).
+func SetDumpFormat(format string) error {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "hex":
+		dumpFormat = Hex
+	case "decoded":
+		dumpFormat = Decoded
+	case "both":
+		dumpFormat = Both
+	default:
+		return fmt.Errorf("invalid debug format '%v' (expected hex, decoded or both)", format)
+	}
+
+	return nil
+}
+
+func (c Conn) DumpRequestf(message []byte, format string, args ...any) {
+	dumpf(c.Tag, Request, message, format, args...)
+}
+
+func (c Conn) DumpReplyf(message []byte, format string, args ...any) {
+	dumpf(c.Tag, Reply, message, format, args...)
+}
+
+func (c Conn) DumpEventf(message []byte, format string, args ...any) {
+	dumpf(c.Tag, Event, message, format, args...)
+}
+
+func dumpf(tag string, kind Kind, message []byte, format string, args ...any) {
+	indent := "                                      "
+
+	switch dumpFormat {
+	case Decoded:
+		debugf(tag, "%v\n%v", fmt.Sprintf(format, args...), Decode(kind, message, indent))
+
+	case Both:
+		debugf(tag, "%v\n%v\n%s", fmt.Sprintf(format, args...), Decode(kind, message, indent), Dump(message, indent))
+
+	default:
+		Dumpf(tag, message, format, args...)
+	}
+}
+
+// Decode returns the function name, controller serial number and decoded fields of a UHPPOTE message, one
+// field per line. Messages that are not valid UHPPOTE messages or that cannot be decoded are marked as
+// INVALID or UNKNOWN.
+func Decode(kind Kind, message []byte, indent string) string {
+	var v any
+	var err error
+
+	switch {
+	case len(message) != 64:
+		return fmt.Sprintf("%v*** INVALID %v (%v bytes) ***", indent, kind, len(message))
+
+	case message[0] != 0x17 && (kind != Event || message[0] != 0x19):
+		return fmt.Sprintf("%v*** INVALID %v (start of message 0x%02x) ***", indent, kind, message[0])
+
+	case !protocol.IsFunction(message[1]):
+		return fmt.Sprintf("%v*** UNKNOWN %v (function 0x%02x) ***", indent, kind, message[1])
+
+	case kind == Request:
+		v, err = messages.UnmarshalRequest(message)
+
+	case kind == Reply:
+		v, err = messages.UnmarshalResponse(message)
+
+	case kind == Event && message[0] == 0x19:
+		e := messages.EventV6_62{}
+		err = codec.Unmarshal(message, &e)
+		v = e.Event
+
+	case kind == Event:
+		e := messages.Event{}
+		err = codec.Unmarshal(message, &e)
+		v = e
+	}
+
+	if err != nil {
+		return fmt.Sprintf("%v*** INVALID %v %v (%v) ***", indent, protocol.FunctionName(message[1]), kind, err)
+	} else if v == nil {
+		return fmt.Sprintf("%v*** UNKNOWN %v (function 0x%02x) ***", indent, kind, message[1])
+	}
+
+	return fields(kind, message[1], v, indent)
+}
+
+func fields(kind Kind, function byte, v any, indent string) string {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+
+	var b strings.Builder
+	var serial any
+
+	list := [][2]string{}
+	width := 0
+
+	for i := 0; i < rt.NumField(); i++ {
+		name := rt.Field(i).Name
+
+		switch name {
+		case "MsgType", "SOM":
+			continue
+
+		case "SerialNumber":
+			serial = rv.Field(i).Interface()
+			continue
+		}
+
+		list = append(list, [2]string{name, fmt.Sprintf("%v", rv.Field(i).Interface())})
+		width = max(width, len(name))
+	}
+
+	fmt.Fprintf(&b, "%v%v %v  %v", indent, protocol.FunctionName(function), kind, strings.TrimSpace(fmt.Sprintf("%v", serial)))
+
+	for _, f := range list {
+		fmt.Fprintf(&b, "\n%v  %-*v  %v", indent, width+1, f[0]+":", f[1])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package conn
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeReply(t *testing.T) {
+	reply := []byte{
+		0x17, 0x94, 0x00, 0x00, 0x78, 0x37, 0x2a, 0x18, 0xc0, 0xa8, 0x01, 0x64, 0xff, 0xff, 0xff, 0x00,
+		0xc0, 0xa8, 0x01, 0x01, 0x00, 0x12, 0x23, 0x34, 0x45, 0x56, 0x08, 0x92, 0x20, 0x18, 0x11, 0x05,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+
+	expected := []string{
+		"get-device reply  405419896",
+		"  IpAddress:   192.168.1.100",
+		"  SubnetMask:  255.255.255.0",
+		"  Gateway:     192.168.1.1",
+		"  MacAddress:  00:12:23:34:45:56",
+		"  Version:     v8.92",
+		"  Date:        2018-11-05",
+	}
+
+	if decoded := Decode(Reply, reply, ""); decoded != strings.Join(expected, "\n") {
+		t.Errorf("incorrectly decoded reply\n   expected:\n%v\n   got:\n%v", strings.Join(expected, "\n"), decoded)
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	request := make([]byte, 64)
+	request[0] = 0x17
+	request[1] = 0x40
+	request[4] = 0x78
+	request[5] = 0x37
+	request[6] = 0x2a
+	request[7] = 0x18
+	request[8] = 3
+
+	expected := "open-door request  405419896\n  Door:  3"
+
+	if decoded := Decode(Request, request, ""); decoded != expected {
+		t.Errorf("incorrectly decoded request\n   expected:\n%v\n   got:\n%v", expected, decoded)
+	}
+}
+
+func TestDecodeInvalidMessage(t *testing.T) {
+	tests := []struct {
+		message  []byte
+		expected string
+	}{
+		{[]byte{0x17, 0x94, 0x00, 0x00}, "*** INVALID request (4 bytes) ***"},
+		{append([]byte{0x18, 0x94}, make([]byte, 62)...), "*** INVALID request (start of message 0x18) ***"},
+		{append([]byte{0x17, 0xff}, make([]byte, 62)...), "*** UNKNOWN request (function 0xff) ***"},
+	}
+
+	for _, v := range tests {
+		if decoded := Decode(Request, v.message, ""); decoded != v.expected {
+			t.Errorf("incorrectly decoded message\n   expected:%v\n   got:     %v", v.expected, decoded)
+		}
+	}
+}
+
+func TestSetDumpFormat(t *testing.T) {
+	defer SetDumpFormat("hex")
+
+	if err := SetDumpFormat("decoded"); err != nil || dumpFormat != Decoded {
+		t.Errorf("incorrect dump format - expected:%v, got:%v (%v)", Decoded, dumpFormat, err)
+	}
+
+	if err := SetDumpFormat("qwerty"); err == nil {
+		t.Errorf("expected error for invalid dump format")
+	}
+}
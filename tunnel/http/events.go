@@ -0,0 +1,289 @@
+package http
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nhooyr.io/websocket"
+
+	codec "github.com/uhppoted/uhppote-core/encoding/UTO311-L0x"
+	"github.com/uhppoted/uhppote-core/messages"
+)
+
+// hub distributes the events received by the HTTP connector to the /events subscribers. Each subscriber
+// has its own buffer and events are dropped for subscribers that are not keeping up rather than blocking
+// the tunnel.
+type hub struct {
+	subscribers map[*subscriber]struct{}
+	sync.RWMutex
+}
+
+type subscriber struct {
+	controllers []uint32
+	ch          chan []byte
+	dropped     atomic.Uint64
+}
+
+type notification struct {
+	ID         uint32  `json:"id"`
+	Controller uint32  `json:"controller"`
+	Raw        slice   `json:"raw"`
+	Event      *status `json:"event,omitempty"`
+}
+
+const EVENTS_BUFFER = 64
+const EVENTS_KEEPALIVE = 15 * time.Second
+const EVENTS_WRITE_TIMEOUT = 5 * time.Second
+
+func newHub() *hub {
+	return &hub{
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+func (h *hub) add(controllers []uint32) *subscriber {
+	s := subscriber{
+		controllers: controllers,
+		ch:          make(chan []byte, EVENTS_BUFFER),
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.subscribers[&s] = struct{}{}
+
+	return &s
+}
+
+func (h *hub) remove(s *subscriber) {
+	h.Lock()
+	defer h.Unlock()
+
+	delete(h.subscribers, s)
+}
+
+// publish decodes an event and queues the raw and decoded event for each subscriber listening for
+// events from the controller. Returns the number of subscribers that dropped the event.
+func (h *hub) publish(id uint32, message []byte) (int, error) {
+	controller := uint32(0)
+	if len(message) >= 8 {
+		controller = binary.LittleEndian.Uint32(message[4:8])
+	}
+
+	n := notification{
+		ID:         id,
+		Controller: controller,
+		Raw:        message,
+		Event:      decodeEvent(message),
+	}
+
+	bytes, err := json.Marshal(n)
+	if err != nil {
+		return 0, err
+	}
+
+	h.RLock()
+	defer h.RUnlock()
+
+	dropped := 0
+	for s := range h.subscribers {
+		if s.listening(controller) {
+			select {
+			case s.ch <- bytes:
+			default:
+				s.dropped.Add(1)
+				dropped++
+			}
+		}
+	}
+
+	return dropped, nil
+}
+
+func (s *subscriber) listening(controller uint32) bool {
+	if len(s.controllers) == 0 {
+		return true
+	}
+
+	for _, v := range s.controllers {
+		if v == controller {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subscribe handles /events subscriptions, streaming the events as WebSocket messages if the request is
+// a WebSocket upgrade and as Server-Sent Events otherwise. The optional 'controller' query parameter
+// restricts the events to a list of controllers.
+func (h *httpd) subscribe(w http.ResponseWriter, r *http.Request) {
+	controllers := []uint32{}
+	for _, q := range r.URL.Query()["controller"] {
+		for _, v := range split(q) {
+			if controller, err := strconv.ParseUint(v, 10, 32); err != nil || controller == 0 {
+				http.Error(w, fmt.Sprintf("Invalid controller (%v)", v), http.StatusBadRequest)
+				return
+			} else {
+				controllers = append(controllers, uint32(controller))
+			}
+		}
+	}
+
+	s := h.events.add(controllers)
+
+	defer h.events.remove(s)
+
+	h.extend(w, 0)
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		h.Infof("websocket event subscriber %v", r.RemoteAddr)
+		h.websocket(w, r, s)
+	} else {
+		h.Infof("SSE event subscriber %v", r.RemoteAddr)
+		h.sse(w, r, s)
+	}
+
+	if dropped := s.dropped.Load(); dropped > 0 {
+		h.Warnf("event subscriber %v dropped %v events", r.RemoteAddr, dropped)
+	}
+
+	h.Infof("event subscriber %v closed", r.RemoteAddr)
+}
+
+func (h *httpd) sse(w http.ResponseWriter, r *http.Request, s *subscriber) {
+	rc := http.NewResponseController(w)
+	keepalive := time.NewTicker(EVENTS_KEEPALIVE)
+
+	defer keepalive.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		h.Warnf("%v", err)
+		return
+	}
+
+	write := func(s string) bool {
+		rc.SetWriteDeadline(time.Now().Add(EVENTS_WRITE_TIMEOUT))
+
+		if _, err := fmt.Fprint(w, s); err != nil {
+			return false
+		} else if err := rc.Flush(); err != nil {
+			return false
+		}
+
+		return true
+	}
+
+	for {
+		select {
+		case event := <-s.ch:
+			if !write(fmt.Sprintf("event: event\ndata: %s\n\n", event)) {
+				return
+			}
+
+		case <-keepalive.C:
+			if !write(": keepalive\n\n") {
+				return
+			}
+
+		case <-r.Context().Done():
+			return
+
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *httpd) websocket(w http.ResponseWriter, r *http.Request, s *subscriber) {
+	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		OriginPatterns: h.policy.hosts(),
+	})
+
+	if err != nil {
+		h.Warnf("%v", err)
+		return
+	}
+
+	defer c.CloseNow()
+
+	ctx := c.CloseRead(r.Context())
+	keepalive := time.NewTicker(EVENTS_KEEPALIVE)
+
+	defer keepalive.Stop()
+
+	write := func(f func(context.Context) error) bool {
+		ctx, cancel := context.WithTimeout(ctx, EVENTS_WRITE_TIMEOUT)
+		defer cancel()
+
+		return f(ctx) == nil
+	}
+
+	for {
+		select {
+		case event := <-s.ch:
+			if !write(func(ctx context.Context) error { return c.Write(ctx, websocket.MessageText, event) }) {
+				return
+			}
+
+		case <-keepalive.C:
+			if !write(c.Ping) {
+				return
+			}
+
+		case <-ctx.Done():
+			return
+
+		case <-h.ctx.Done():
+			c.Close(websocket.StatusGoingAway, "closing")
+			return
+		}
+	}
+}
+
+func decodeEvent(message []byte) *status {
+	e := messages.Event{}
+	if err := codec.Unmarshal(message, &e); err != nil {
+		return nil
+	}
+
+	v := status{
+		Controller:  uint32(e.SerialNumber),
+		SystemTime:  fmt.Sprintf("%v %v", e.SystemDate, e.SystemTime),
+		Doors:       map[uint8]bool{1: e.Door1State, 2: e.Door2State, 3: e.Door3State, 4: e.Door4State},
+		Buttons:     map[uint8]bool{1: e.Door1Button, 2: e.Door2Button, 3: e.Door3Button, 4: e.Door4Button},
+		Relays:      e.RelayState,
+		Inputs:      e.InputState,
+		SystemError: e.SystemError,
+		SpecialInfo: e.SpecialInfo,
+		SequenceNo:  e.SequenceId,
+	}
+
+	if e.EventIndex != 0 {
+		v.Event = &event{
+			Index:     e.EventIndex,
+			Type:      e.EventType,
+			Granted:   e.Granted,
+			Door:      e.Door,
+			Direction: e.Direction,
+			Card:      e.CardNumber,
+			Timestamp: e.Timestamp,
+			Reason:    e.Reason,
+		}
+	}
+
+	return &v
+}
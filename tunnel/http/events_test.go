@@ -0,0 +1,174 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+func TestHubPublish(t *testing.T) {
+	h := newHub()
+	all := h.add(nil)
+	filtered := h.add([]uint32{405419896})
+
+	for _, controller := range []uint32{405419896, 303986753} {
+		if dropped, err := h.publish(19, eventMessage(controller)); err != nil {
+			t.Fatalf("error publishing event (%v)", err)
+		} else if dropped != 0 {
+			t.Errorf("incorrect number of dropped events - expected:%v, got:%v", 0, dropped)
+		}
+	}
+
+	tests := []struct {
+		subscriber *subscriber
+		expected   []uint32
+	}{
+		{all, []uint32{405419896, 303986753}},
+		{filtered, []uint32{405419896}},
+	}
+
+	for i, v := range tests {
+		received := []uint32{}
+
+		for len(v.subscriber.ch) > 0 {
+			n := notification{}
+			if err := json.Unmarshal(<-v.subscriber.ch, &n); err != nil {
+				t.Fatalf("subscriber %v: invalid notification (%v)", i+1, err)
+			} else if n.ID != 19 {
+				t.Errorf("subscriber %v: incorrect ID - expected:%v, got:%v", i+1, 19, n.ID)
+			}
+
+			received = append(received, n.Controller)
+		}
+
+		if !slices.Equal(received, v.expected) {
+			t.Errorf("subscriber %v: incorrect events - expected:%v, got:%v", i+1, v.expected, received)
+		}
+	}
+}
+
+func TestHubDropsEventsForSlowSubscribers(t *testing.T) {
+	h := newHub()
+	slow := h.add(nil)
+	other := h.add([]uint32{303986753})
+
+	dropped := 0
+	for i := 0; i < EVENTS_BUFFER+10; i++ {
+		if n, err := h.publish(uint32(i), eventMessage(405419896)); err != nil {
+			t.Fatalf("error publishing event (%v)", err)
+		} else {
+			dropped += n
+		}
+	}
+
+	if dropped != 10 {
+		t.Errorf("incorrect number of dropped events - expected:%v, got:%v", 10, dropped)
+	}
+
+	if n := slow.dropped.Load(); n != 10 {
+		t.Errorf("incorrect subscriber dropped count - expected:%v, got:%v", 10, n)
+	}
+
+	if n := len(slow.ch); n != EVENTS_BUFFER {
+		t.Errorf("incorrect number of queued events - expected:%v, got:%v", EVENTS_BUFFER, n)
+	}
+
+	if n := other.dropped.Load(); n != 0 || len(other.ch) != 0 {
+		t.Errorf("events queued for unsubscribed controller (queued:%v, dropped:%v)", len(other.ch), n)
+	}
+}
+
+func TestHubRemove(t *testing.T) {
+	h := newHub()
+	s := h.add(nil)
+
+	h.remove(s)
+
+	if _, err := h.publish(19, eventMessage(405419896)); err != nil {
+		t.Fatalf("error publishing event (%v)", err)
+	} else if n := len(s.ch); n != 0 {
+		t.Errorf("event published to removed subscriber (%v)", n)
+	}
+}
+
+func TestSSE(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := httpd{
+		Conn:   conn.Conn{Tag: "HTTP"},
+		events: newHub(),
+		ctx:    ctx,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(h.subscribe))
+	defer server.Close()
+
+	if response, err := http.Get(server.URL + "/events?controller=0"); err != nil {
+		t.Fatalf("%v", err)
+	} else if response.Body.Close(); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("incorrect status for invalid controller - expected:%v, got:%v", http.StatusBadRequest, response.StatusCode)
+	}
+
+	response, err := http.Get(server.URL + "/events?controller=405419896")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer response.Body.Close()
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("incorrect content-type - expected:%v, got:%v", "text/event-stream", contentType)
+	}
+
+	h.events.publish(18, eventMessage(303986753))
+	h.events.publish(19, eventMessage(405419896))
+
+	lines := make(chan string, 16)
+	go func() {
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+
+		close(lines)
+	}()
+
+	expected := []string{"event: event", "data: "}
+	for _, v := range expected {
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, v) {
+				t.Fatalf("incorrect SSE line - expected:%v, got:%v", v, line)
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+				n := notification{}
+				if err := json.Unmarshal([]byte(data), &n); err != nil {
+					t.Fatalf("invalid event data (%v)", err)
+				} else if n.ID != 19 || n.Controller != 405419896 {
+					t.Errorf("incorrect event - expected:%v/%v, got:%v/%v", 19, 405419896, n.ID, n.Controller)
+				}
+			}
+
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for event")
+		}
+	}
+}
+
+func eventMessage(controller uint32) []byte {
+	message := make([]byte, 64)
+	message[0] = 0x17
+	message[1] = 0x20
+	binary.LittleEndian.PutUint32(message[4:8], controller)
+
+	return message
+}
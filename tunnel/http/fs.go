@@ -1,13 +1,39 @@
 package http
 
 import (
+	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"strings"
+
+	core "github.com/uhppoted/uhppote-core/uhppote"
+
+	"github.com/uhppoted/uhppoted-tunnel/examples"
 )
 
+// filesystem serves the static HTML for the HTTP connectors from the HTML folder or, if no folder is
+// specified, from the example web UI embedded in the binary.
 type filesystem struct {
 	http.FileSystem
+	embedded bool
+}
+
+const MAX_AGE = 3600
+
+func newFilesystem(html string) filesystem {
+	if html == "" {
+		if sub, err := fs.Sub(examples.HTML, "html"); err == nil {
+			return filesystem{
+				FileSystem: http.FS(sub),
+				embedded:   true,
+			}
+		}
+	}
+
+	return filesystem{
+		FileSystem: http.FS(os.DirFS(html)),
+	}
 }
 
 func (fss filesystem) Open(name string) (http.File, error) {
@@ -26,6 +52,20 @@ func (fss filesystem) Open(name string) (http.File, error) {
 	return file{f}, nil
 }
 
+// ServeHTTP serves the static files with cache headers. The embedded files do not have a modification
+// time and can only change with the binary so they are tagged with the version and cached for an hour,
+// while files served from an HTML folder are revalidated (using the modification time) on every request.
+func (fss filesystem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if fss.embedded {
+		w.Header().Set("ETag", fmt.Sprintf(`"uhppoted-tunnel-%v"`, core.VERSION))
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%v", MAX_AGE))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	http.FileServer(fss).ServeHTTP(w, r)
+}
+
 type file struct {
 	http.File
 }
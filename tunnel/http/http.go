@@ -3,17 +3,19 @@ package http
 import (
 	"compress/gzip"
 	"context"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/acl"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/auth"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
 )
 
@@ -23,6 +25,13 @@ type httpd struct {
 	retry   conn.Backoff
 	timeout time.Duration
 	fs      filesystem
+	acl     *acl.ACL
+	auth    *auth.Auth
+	policy  *Policy
+	server  *Server
+	events  *hub
+	out     bool
+	reverse *queue
 	ctx     context.Context
 	ch      chan protocol.Message
 	closed  chan struct{}
@@ -59,7 +68,7 @@ func (d *duration) UnmarshalJSON(b []byte) (err error) {
 
 const GZIP_MINIMUM = 16384
 
-func NewHTTP(spec string, html string, retry conn.Backoff, ctx context.Context) (*httpd, error) {
+func NewHTTP(spec string, html string, authentication *auth.Auth, policy *Policy, server *Server, retry conn.Backoff, ctx context.Context) (*httpd, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 	if err != nil {
 		return nil, err
@@ -69,8 +78,10 @@ func NewHTTP(spec string, html string, retry conn.Backoff, ctx context.Context)
 		return nil, fmt.Errorf("unable to resolve HTTP base address '%v'", spec)
 	}
 
-	fs := filesystem{
-		FileSystem: http.FS(os.DirFS(html)),
+	fs := newFilesystem(html)
+
+	if server == nil {
+		server = NewServer(0, 0, 0, 0, 0)
 	}
 
 	h := httpd{
@@ -81,6 +92,10 @@ func NewHTTP(spec string, html string, retry conn.Backoff, ctx context.Context)
 		retry:   retry,
 		timeout: 5 * time.Second,
 		fs:      fs,
+		auth:    authentication,
+		policy:  policy,
+		server:  server,
+		events:  newHub(),
 		ctx:     ctx,
 		ch:      make(chan protocol.Message, 16),
 		closed:  make(chan struct{}),
@@ -89,6 +104,19 @@ func NewHTTP(spec string, html string, retry conn.Backoff, ctx context.Context)
 	return &h, nil
 }
 
+// NewHTTPEventOut creates an HTTP connector that streams the events received from the tunnel to /events
+// subscribers. The request endpoints are not available on an event connector.
+func NewHTTPEventOut(spec string, html string, authentication *auth.Auth, policy *Policy, server *Server, retry conn.Backoff, ctx context.Context) (*httpd, error) {
+	h, err := NewHTTP(spec, html, authentication, policy, server, retry, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	h.out = true
+
+	return h, nil
+}
+
 func (h *httpd) Close() {
 	h.Infof("closing")
 
@@ -103,15 +131,9 @@ func (h *httpd) Close() {
 }
 
 func (h *httpd) Run(router *router.Switch) error {
-	mux := http.NewServeMux()
-
-	mux.Handle("/", http.FileServer(h.fs))
-	mux.HandleFunc("/udp/broadcast", func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) })
-	mux.HandleFunc("/udp/send", func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) })
-
-	srv := &http.Server{
-		Addr:    fmt.Sprintf("%v", h.addr),
-		Handler: mux,
+	srv, err := h.newServer(h.mux(router), nil)
+	if err != nil {
+		return err
 	}
 
 	closing := false
@@ -150,7 +172,63 @@ func (h *httpd) Run(router *router.Switch) error {
 	return nil
 }
 
+// Send queues requests for the http/poll connector (reverse tunnel) or publishes events (and any other
+// unsolicited messages) to the /events subscribers.
 func (h *httpd) Send(id uint32, msg []byte) {
+	if h.reverse != nil {
+		h.DumpRequestf(msg, "request %v  %v bytes", id, len(msg))
+
+		if err := h.reverse.push(id, msg); err != nil {
+			h.Warnf("%v", err)
+		}
+
+		return
+	}
+
+	h.DumpEventf(msg, "event %v  %v bytes", id, len(msg))
+
+	if dropped, err := h.events.publish(id, msg); err != nil {
+		h.Warnf("%v", err)
+	} else if dropped > 0 {
+		h.Warnf("event %v dropped by %v subscribers", id, dropped)
+	}
+}
+
+func (h *httpd) mux(router *router.Switch) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/", h.fs)
+	mux.HandleFunc("GET /openapi.json", h.openapi)
+	mux.HandleFunc("GET /events", h.authenticate(h.subscribe))
+
+	if h.reverse != nil {
+		mux.HandleFunc("GET /poll", h.authenticate(h.poll))
+		mux.HandleFunc("POST /reply", h.authenticate(func(w http.ResponseWriter, r *http.Request) { h.replied(w, r, router) }))
+	} else if !h.out {
+		mux.HandleFunc("/udp/broadcast", h.authenticate(func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) }))
+		mux.HandleFunc("/udp/send", h.authenticate(func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) }))
+
+		h.api(mux, router)
+	}
+
+	return h.secure(mux)
+}
+
+// authenticate rejects requests without valid credentials (if HTTP authentication is configured) and
+// requests for endpoints the user is not permitted to use.
+func (h *httpd) authenticate(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if principal, err := h.auth.Authenticate(r); err != nil {
+			h.Warnf("%v %v from %v rejected (%v)", r.Method, r.URL.Path, r.RemoteAddr, err)
+			h.auth.Challenge(w)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		} else if err := h.auth.Allow(principal, r.URL.Path); err != nil {
+			h.Warnf("%v %v from %v rejected (%v)", r.Method, r.URL.Path, r.RemoteAddr, err)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		} else {
+			f(w, r)
+		}
+	}
 }
 
 func (h *httpd) dispatch(w http.ResponseWriter, r *http.Request, router *router.Switch) {
@@ -204,9 +282,9 @@ func (h *httpd) broadcast(w http.ResponseWriter, r *http.Request, router *router
 			return
 		}
 
-		if err := json.Unmarshal(blob, &body); err != nil {
+		if err := decode(blob, "BroadcastRequest", &body); err != nil {
 			h.Warnf("%v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("Invalid request body (%v)", err), http.StatusBadRequest)
 			return
 		}
 
@@ -216,23 +294,31 @@ func (h *httpd) broadcast(w http.ResponseWriter, r *http.Request, router *router
 		return
 	}
 
+	if err := h.authorised(r, body.Request); err != nil {
+		h.Warnf("%v", err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	id := protocol.NextID()
 	replies := []slice{}
 	received := make(chan []byte)
 	wait := time.Duration(body.Wait)
+
+	h.extend(w, wait+10*time.Second)
 	waited := time.After(wait)
 	ctx, cancel := context.WithTimeout(h.ctx, wait+5*time.Second)
 
 	defer cancel()
 
-	h.Dumpf(body.Request, "request %v  %v bytes from %v", id, len(body.Request), r.RemoteAddr)
+	h.DumpRequestf(body.Request, "request %v  %v bytes from %v", id, len(body.Request), r.RemoteAddr)
 
 	router.Received(id, body.Request, func(reply []byte) { received <- reply })
 
 	for {
 		select {
 		case reply := <-received:
-			h.Dumpf(reply, "reply %v  %v bytes for %v", id, len(reply), r.RemoteAddr)
+			h.DumpReplyf(reply, "reply %v  %v bytes for %v", id, len(reply), r.RemoteAddr)
 			replies = append(replies, reply)
 
 		case <-ctx.Done():
@@ -293,9 +379,9 @@ func (h *httpd) send(w http.ResponseWriter, r *http.Request, router *router.Swit
 			return
 		}
 
-		if err := json.Unmarshal(blob, &body); err != nil {
+		if err := decode(blob, "SendRequest", &body); err != nil {
 			h.Warnf("%v", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			http.Error(w, fmt.Sprintf("Invalid request body (%v)", err), http.StatusBadRequest)
 			return
 		}
 
@@ -305,12 +391,18 @@ func (h *httpd) send(w http.ResponseWriter, r *http.Request, router *router.Swit
 		return
 	}
 
+	if err := h.authorised(r, body.Request); err != nil {
+		h.Warnf("%v", err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	id := protocol.NextID()
 	ctx, cancel := context.WithTimeout(h.ctx, 5*time.Second)
 
 	defer cancel()
 
-	h.Dumpf(body.Request, "request %v  %v bytes from %v", id, len(body.Request), r.RemoteAddr)
+	h.DumpRequestf(body.Request, "request %v  %v bytes from %v", id, len(body.Request), r.RemoteAddr)
 
 	// ... set-ip request does not expect a response
 	if !body.Wait {
@@ -334,7 +426,7 @@ func (h *httpd) send(w http.ResponseWriter, r *http.Request, router *router.Swit
 	for {
 		select {
 		case reply := <-received:
-			h.Dumpf(reply, "reply %v  %v bytes for %v", id, len(reply), r.RemoteAddr)
+			h.DumpReplyf(reply, "reply %v  %v bytes for %v", id, len(reply), r.RemoteAddr)
 
 			response := struct {
 				ID    int   `json:"ID"`
@@ -355,6 +447,19 @@ func (h *httpd) send(w http.ResponseWriter, r *http.Request, router *router.Swit
 	}
 }
 
+func (h *httpd) authorised(r *http.Request, request []byte) error {
+	if h.acl == nil {
+		return nil
+	}
+
+	var certificate *x509.Certificate
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		certificate = r.TLS.PeerCertificates[0]
+	}
+
+	return h.acl.Allow(certificate, request)
+}
+
 func (h *httpd) reply(response any, w http.ResponseWriter, acceptsGzip bool) {
 	if b, err := json.Marshal(response); err != nil {
 		h.Warnf("%v", err)
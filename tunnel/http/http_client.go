@@ -0,0 +1,295 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/pki"
+)
+
+// httpClient is an OUT connector that forwards requests to the /udp/send and /udp/broadcast endpoints
+// of a remote HTTP/HTTPS tunnel (typically behind a reverse proxy) and returns the replies to the router.
+type httpClient struct {
+	conn.Conn
+	url     *url.URL
+	client  *http.Client
+	token   string
+	timeout time.Duration
+	ctx     context.Context
+	ch      chan protocol.Message
+	closed  chan struct{}
+}
+
+// NewHTTPClient creates an HTTP client OUT connector for the remote tunnel base URL e.g.
+// https://tunnel.example.com/uhppoted. The CA certificate, client certificate, bearer token and proxy
+// are optional. Without a proxy the connector uses the proxy defined by the HTTP_PROXY, HTTPS_PROXY
+// and NO_PROXY environment variables.
+func NewHTTPClient(spec string, ca *x509.CertPool, certificate *tls.Certificate, options *pki.Options, token string, proxy string, timeout time.Duration, ctx context.Context) (*httpClient, error) {
+	base, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	} else if (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid HTTP client URL '%v'", spec)
+	}
+
+	bearer, err := bearerToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := newTransport(ca, certificate, options, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	h := httpClient{
+		Conn: conn.Conn{
+			Tag: "HTTP",
+		},
+		url: base,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout + 10*time.Second,
+		},
+		token:   bearer,
+		timeout: timeout,
+		ctx:     ctx,
+		ch:      make(chan protocol.Message),
+		closed:  make(chan struct{}),
+	}
+
+	h.Infof("connector::http-client %v", base.Redacted())
+
+	return &h, nil
+}
+
+func (h *httpClient) Close() {
+	h.Infof("closing")
+
+	h.client.CloseIdleConnections()
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-h.closed:
+		h.Infof("closed")
+
+	case <-timeout.C:
+		h.Infof("close timeout")
+	}
+}
+
+func (h *httpClient) Run(router *router.Switch) error {
+loop:
+	for {
+		select {
+		case msg := <-h.ch:
+			router.Received(msg.ID, msg.Message, nil)
+
+		case <-h.ctx.Done():
+			break loop
+		}
+	}
+
+	close(h.closed)
+
+	return nil
+}
+
+func (h *httpClient) Send(id uint32, msg []byte) {
+	go func() {
+		h.send(id, msg)
+	}()
+}
+
+// send POSTs broadcast requests (controller 0) to /udp/broadcast and all other requests to /udp/send.
+// set-address requests are sent without waiting for a reply because the controller does not reply.
+func (h *httpClient) send(id uint32, message []byte) {
+	controller := uint32(0)
+	if len(message) >= 8 {
+		controller = binary.LittleEndian.Uint32(message[4:8])
+	}
+
+	h.DumpRequestf(message, "request %v  %v bytes", id, len(message))
+
+	switch {
+	case controller == 0:
+		request := struct {
+			ID      uint32 `json:"ID"`
+			Wait    string `json:"wait"`
+			Request slice  `json:"request"`
+		}{
+			ID:      id & 0x7fffffff,
+			Wait:    h.timeout.String(),
+			Request: message,
+		}
+
+		response := struct {
+			Replies [][]byte `json:"replies"`
+		}{}
+
+		if h.post(id, "udp/broadcast", request, &response) {
+			for _, reply := range response.Replies {
+				h.DumpReplyf(reply, "reply %v  %v bytes", id, len(reply))
+				h.received(id, reply)
+			}
+		}
+
+	default:
+		request := struct {
+			ID      uint32 `json:"ID"`
+			Wait    bool   `json:"wait"`
+			Request slice  `json:"request"`
+		}{
+			ID:      id & 0x7fffffff,
+			Wait:    len(message) < 2 || message[1] != 0x96,
+			Request: message,
+		}
+
+		response := struct {
+			Reply []byte `json:"reply"`
+		}{}
+
+		if h.post(id, "udp/send", request, &response) && len(response.Reply) > 0 {
+			h.DumpReplyf(response.Reply, "reply %v  %v bytes", id, len(response.Reply))
+			h.received(id, response.Reply)
+		}
+	}
+}
+
+// received queues a reply for the router, discarding it if the connector is closed before the reply
+// can be delivered.
+func (h *httpClient) received(id uint32, reply []byte) {
+	select {
+	case h.ch <- protocol.Message{ID: id, Message: reply}:
+	case <-h.ctx.Done():
+	}
+}
+
+func (h *httpClient) post(id uint32, endpoint string, request any, response any) bool {
+	body, err := json.Marshal(request)
+	if err != nil {
+		h.Warnf("%v", err)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, h.timeout+10*time.Second)
+	defer cancel()
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url.JoinPath(endpoint).String(), bytes.NewReader(body))
+	if err != nil {
+		h.Warnf("%v", err)
+		return false
+	}
+
+	rq.Header.Set("Content-Type", "application/json")
+	if h.token != "" {
+		rq.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	h.Debugf("request %v  POST %v", id, rq.URL.Redacted())
+
+	rs, err := h.client.Do(rq)
+	if err != nil {
+		h.Warnf("%v", err)
+		return false
+	}
+
+	defer rs.Body.Close()
+
+	blob, err := io.ReadAll(rs.Body)
+	if err != nil {
+		h.Warnf("%v", err)
+		return false
+	}
+
+	if rs.StatusCode != http.StatusOK {
+		h.Warnf("request %v failed (%v %v)", id, rs.Status, strings.TrimSpace(string(blob)))
+		return false
+	}
+
+	if err := json.Unmarshal(blob, response); err != nil {
+		h.Warnf("invalid reply to request %v (%v)", id, err)
+		return false
+	}
+
+	return true
+}
+
+// newTransport creates the keep-alive HTTP transport for the HTTP client connectors.
+func newTransport(ca *x509.CertPool, certificate *tls.Certificate, options *pki.Options, proxy string) (*http.Transport, error) {
+	config := tls.Config{
+		RootCAs: ca,
+	}
+
+	options.Apply(&config)
+
+	if certificate != nil {
+		config.Certificates = []tls.Certificate{*certificate}
+	}
+
+	transport := http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       &config,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          16,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	if proxy != "" {
+		if u, err := url.Parse(proxy); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid HTTP proxy URL '%v'", proxy)
+		} else {
+			transport.Proxy = http.ProxyURL(u)
+		}
+	}
+
+	return &transport, nil
+}
+
+// bearerToken loads the bearer token from an environment variable ('env:<variable>'), a file
+// ('file:<path>') or returns the token as is.
+func bearerToken(spec string) (string, error) {
+	switch {
+	case spec == "":
+		return "", nil
+
+	case strings.HasPrefix(spec, "env:"):
+		if v, ok := os.LookupEnv(spec[4:]); !ok {
+			return "", fmt.Errorf("HTTP bearer token environment variable %v not defined", spec[4:])
+		} else {
+			return strings.TrimSpace(v), nil
+		}
+
+	case strings.HasPrefix(spec, "file:"):
+		if b, err := os.ReadFile(spec[5:]); err != nil {
+			return "", err
+		} else {
+			return strings.TrimSpace(string(b)), nil
+		}
+
+	default:
+		return strings.TrimSpace(spec), nil
+	}
+}
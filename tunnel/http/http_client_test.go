@@ -0,0 +1,29 @@
+package http
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientDiscardsRepliesAfterClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h, err := NewHTTPClient("http://127.0.0.1:8080", nil, nil, nil, "", "", 1*time.Second, ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		h.received(19, []byte{0x17, 0x94})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Errorf("blocked delivering reply to closed connector")
+	}
+}
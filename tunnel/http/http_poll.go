@@ -0,0 +1,219 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/pki"
+)
+
+// httpPoll is the site side of a reverse tunnel. It is an IN connector that long-polls the /poll
+// endpoint of a central http/reverse or https/reverse connector for pending requests and posts the
+// replies to the /reply endpoint, so that the site does not need to accept inbound connections.
+type httpPoll struct {
+	conn.Conn
+	url    *url.URL
+	client *http.Client
+	token  string
+	retry  conn.Backoff
+	ctx    context.Context
+	closed chan struct{}
+}
+
+// NewHTTPPoll creates an HTTP poll IN connector for the central tunnel base URL e.g.
+// https://tunnel.example.com/uhppoted. The CA certificate, client certificate, bearer token and proxy
+// are optional.
+func NewHTTPPoll(spec string, ca *x509.CertPool, certificate *tls.Certificate, options *pki.Options, token string, proxy string, retry conn.Backoff, ctx context.Context) (*httpPoll, error) {
+	base, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	} else if (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid HTTP poll URL '%v'", spec)
+	}
+
+	bearer, err := bearerToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := newTransport(ca, certificate, options, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	h := httpPoll{
+		Conn: conn.Conn{
+			Tag: "HTTP",
+		},
+		url: base,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   POLL_WAIT + 10*time.Second,
+		},
+		token:  bearer,
+		retry:  retry,
+		ctx:    ctx,
+		closed: make(chan struct{}),
+	}
+
+	h.Infof("connector::http-poll %v", base.Redacted())
+
+	return &h, nil
+}
+
+func (h *httpPoll) Close() {
+	h.Infof("closing")
+
+	h.client.CloseIdleConnections()
+
+	timeout := time.NewTimer(5 * time.Second)
+	select {
+	case <-h.closed:
+		h.Infof("closed")
+
+	case <-timeout.C:
+		h.Infof("close timeout")
+	}
+}
+
+func (h *httpPoll) Run(router *router.Switch) error {
+	h.Infof("polling %v", h.url.Redacted())
+
+	for {
+		if err := h.poll(router); err != nil && h.ctx.Err() == nil {
+			h.Warnf("%v", err)
+
+			if !h.retry.Wait(h.Tag) {
+				break
+			}
+		} else if h.ctx.Err() != nil {
+			break
+		} else {
+			h.retry.Reset()
+		}
+	}
+
+	close(h.closed)
+
+	return nil
+}
+
+// Send is a no-op - the replies are returned to the central tunnel by the reply handler passed to the
+// router.
+func (h *httpPoll) Send(id uint32, msg []byte) {
+}
+
+// poll retrieves the pending requests from the central tunnel and relays them to the router.
+func (h *httpPoll) poll(router *router.Switch) error {
+	endpoint := h.url.JoinPath("poll")
+	endpoint.RawQuery = url.Values{"wait": []string{POLL_WAIT.String()}}.Encode()
+
+	rq, err := http.NewRequestWithContext(h.ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	if h.token != "" {
+		rq.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	rs, err := h.client.Do(rq)
+	if err != nil {
+		return err
+	}
+
+	defer rs.Body.Close()
+
+	blob, err := io.ReadAll(rs.Body)
+	if err != nil {
+		return err
+	}
+
+	switch rs.StatusCode {
+	case http.StatusNoContent:
+		return nil
+
+	case http.StatusOK:
+		response := struct {
+			Requests []struct {
+				ID      uint32 `json:"ID"`
+				Request []byte `json:"request"`
+			} `json:"requests"`
+		}{}
+
+		if err := json.Unmarshal(blob, &response); err != nil {
+			return fmt.Errorf("invalid poll response (%v)", err)
+		}
+
+		for _, v := range response.Requests {
+			id := v.ID
+
+			h.DumpRequestf(v.Request, "request %v  %v bytes", id, len(v.Request))
+
+			router.Received(id, v.Request, func(reply []byte) {
+				go h.reply(id, reply)
+			})
+		}
+
+		return nil
+
+	default:
+		return fmt.Errorf("poll failed (%v %v)", rs.Status, strings.TrimSpace(string(blob)))
+	}
+}
+
+// reply POSTs a controller reply to the /reply endpoint of the central tunnel.
+func (h *httpPoll) reply(id uint32, reply []byte) {
+	h.DumpReplyf(reply, "reply %v  %v bytes", id, len(reply))
+
+	body, err := json.Marshal(struct {
+		ID    uint32 `json:"ID"`
+		Reply slice  `json:"reply"`
+	}{
+		ID:    id,
+		Reply: reply,
+	})
+
+	if err != nil {
+		h.Warnf("%v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, 10*time.Second)
+	defer cancel()
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url.JoinPath("reply").String(), bytes.NewReader(body))
+	if err != nil {
+		h.Warnf("%v", err)
+		return
+	}
+
+	rq.Header.Set("Content-Type", "application/json")
+	if h.token != "" {
+		rq.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	rs, err := h.client.Do(rq)
+	if err != nil {
+		h.Warnf("%v", err)
+		return
+	}
+
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusNoContent && rs.StatusCode != http.StatusOK {
+		blob, _ := io.ReadAll(rs.Body)
+		h.Warnf("reply %v failed (%v %v)", id, rs.Status, strings.TrimSpace(string(blob)))
+	}
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+func TestHTTPPoll(t *testing.T) {
+	type reply struct {
+		ID    uint32 `json:"ID"`
+		Reply []byte `json:"reply"`
+	}
+
+	id := protocol.NextID()
+	request := eventMessage(405419896)
+	replies := make(chan reply, 1)
+	var polls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+TOKEN {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/poll":
+			if polls.Add(1) == 1 {
+				json.NewEncoder(w).Encode(map[string]any{
+					"requests": []polled{{ID: id, Request: request}},
+				})
+			} else {
+				time.Sleep(50 * time.Millisecond)
+				w.WriteHeader(http.StatusNoContent)
+			}
+
+		case "/reply":
+			v := reply{}
+			if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				replies <- v
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}
+	}))
+
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := NewHTTPPoll(server.URL, nil, nil, nil, TOKEN, "", conn.NewBackoff(1, time.Second, ctx), ctx)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// ... the 'controller' answers the request by echoing it
+	var sw router.Switch
+	sw = router.NewSwitch(func(id uint32, message []byte) {
+		sw.Received(id, message, nil)
+	})
+
+	go h.Run(&sw)
+
+	expected := reply{ID: id, Reply: request}
+
+	select {
+	case v := <-replies:
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("incorrect reply - expected:%v, got:%v", expected, v)
+		}
+
+	case <-time.After(1 * time.Second):
+		t.Fatalf("timeout waiting for reply")
+	}
+
+	cancel()
+	h.Close()
+}
@@ -7,20 +7,23 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/acl"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/auth"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/pki"
 )
 
 type https struct {
 	httpd
-	TLS *tls.Config
+	TLS  *tls.Config
+	acme *pki.ACME
 }
 
-func NewHTTPS(spec string, html string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, ctx context.Context) (*https, error) {
+func NewHTTPS(spec string, html string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, options *pki.Options, revocation *pki.Revocation, permissions *acl.ACL, certificates *pki.ACME, authentication *auth.Auth, policy *Policy, server *Server, retry conn.Backoff, ctx context.Context) (*https, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 	if err != nil {
 		return nil, err
@@ -30,27 +33,37 @@ func NewHTTPS(spec string, html string, ca *x509.CertPool, keypair tls.Certifica
 		return nil, fmt.Errorf("unable to resolve HTTPS base address '%v'", spec)
 	}
 
-	fs := filesystem{
-		FileSystem: http.FS(os.DirFS(html)),
-	}
+	fs := newFilesystem(html)
 
 	config := tls.Config{
 		ClientCAs:    ca,
 		Certificates: []tls.Certificate{keypair},
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-		},
-		ClientAuth: tls.VerifyClientCertIfGiven,
-		MinVersion: tls.VersionTLS12,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
 	}
 
+	options.Apply(&config)
+
 	if requireClientCertificate {
 		config.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 
+	certificates.Apply(&config)
+
+	if revocation != nil {
+		if certificates != nil {
+			config.GetCertificate = revocation.Staple(config.GetCertificate)
+		} else {
+			config.Certificates = nil
+			config.GetCertificate = revocation.GetCertificate(keypair)
+		}
+
+		config.VerifyConnection = revocation.VerifyConnection
+	}
+
+	if server == nil {
+		server = NewServer(0, 0, 0, 0, 0)
+	}
+
 	h := https{
 		httpd: httpd{
 			Conn: conn.Conn{
@@ -60,31 +73,45 @@ func NewHTTPS(spec string, html string, ca *x509.CertPool, keypair tls.Certifica
 			retry:   retry,
 			timeout: 5 * time.Second,
 			fs:      fs,
+			acl:     permissions,
+			auth:    authentication,
+			policy:  policy,
+			server:  server,
+			events:  newHub(),
 			ctx:     ctx,
 			ch:      make(chan protocol.Message, 16),
 			closed:  make(chan struct{}),
 		},
-		TLS: &config,
+		TLS:  &config,
+		acme: certificates,
 	}
 
 	return &h, nil
 }
 
-func (h *https) Run(router *router.Switch) error {
-	mux := http.NewServeMux()
+// NewHTTPSEventOut creates an HTTPS connector that streams the events received from the tunnel to /events
+// subscribers. The request endpoints are not available on an event connector.
+func NewHTTPSEventOut(spec string, html string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, options *pki.Options, revocation *pki.Revocation, certificates *pki.ACME, authentication *auth.Auth, policy *Policy, server *Server, retry conn.Backoff, ctx context.Context) (*https, error) {
+	h, err := NewHTTPS(spec, html, ca, keypair, requireClientCertificate, options, revocation, nil, certificates, authentication, policy, server, retry, ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	mux.Handle("/", http.FileServer(h.fs))
-	mux.HandleFunc("/udp/broadcast", func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) })
-	mux.HandleFunc("/udp/send", func(w http.ResponseWriter, r *http.Request) { h.dispatch(w, r, router) })
+	h.out = true
 
-	srv := &http.Server{
-		Addr:      fmt.Sprintf("%v", h.addr),
-		TLSConfig: h.TLS,
-		Handler:   mux,
+	return h, nil
+}
+
+func (h *https) Run(router *router.Switch) error {
+	srv, err := h.newServer(h.mux(router), h.TLS)
+	if err != nil {
+		return err
 	}
 
 	closing := false
 
+	h.acme.Listen(h.ctx)
+
 	go func() {
 	loop:
 		for {
@@ -0,0 +1,652 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	core "github.com/uhppoted/uhppote-core/uhppote"
+)
+
+// schema is the subset of the OpenAPI 3.0 schema object used to describe (and validate) the HTTP
+// connector request and response bodies. The 'duration', 'date', 'date-time' and 'byte' (base64) formats
+// are checked by the validator, other formats are informational only.
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	OneOf                []*schema          `json:"oneOf,omitempty"`
+	Example              any                `json:"example,omitempty"`
+}
+
+const OPENAPI_VERSION = "3.0.3"
+
+var schemas = map[string]*schema{
+	"BroadcastRequest": object(map[string]*schema{
+		"ID":      describe(integer(0, 2147483647), "Request ID, returned in the reply"),
+		"wait":    describe(format("string", "duration"), "Time to wait for replies (Go duration format, default 5s)"),
+		"request": describe(octets(), "UDP request"),
+	}, "request"),
+
+	"BroadcastResponse": object(map[string]*schema{
+		"ID":      integer(0, 2147483647),
+		"replies": &schema{Type: "array", Items: bytearray()},
+	}),
+
+	"SendRequest": object(map[string]*schema{
+		"ID":      describe(integer(0, 2147483647), "Request ID, returned in the reply"),
+		"wait":    describe(&schema{Type: "boolean"}, "Waits for a reply if true (default). Requests that do not have a reply (e.g. set-IP) should set this to false"),
+		"request": describe(octets(), "UDP request"),
+	}, "request"),
+
+	"SendResponse": object(map[string]*schema{
+		"ID":    integer(0, 2147483647),
+		"reply": describe(bytearray(), "UDP reply (omitted if the request did not wait for a reply)"),
+	}),
+
+	"Device": object(map[string]*schema{
+		"controller": integer(1, 4294967295),
+		"address":    format("string", "ipv4"),
+		"netmask":    format("string", "ipv4"),
+		"gateway":    format("string", "ipv4"),
+		"MAC":        &schema{Type: "string", Example: "00:12:23:34:45:56"},
+		"version":    &schema{Type: "string", Example: "v8.92"},
+		"date":       format("string", "date"),
+	}),
+
+	"Event": object(map[string]*schema{
+		"index":     integer(0, 4294967295),
+		"type":      integer(0, 255),
+		"granted":   &schema{Type: "boolean"},
+		"door":      integer(0, 255),
+		"direction": integer(0, 255),
+		"card":      integer(0, 4294967295),
+		"timestamp": format("string", "date-time"),
+		"reason":    integer(0, 255),
+	}),
+
+	"Status": object(map[string]*schema{
+		"controller":      integer(1, 4294967295),
+		"system-datetime": format("string", "date-time"),
+		"doors":           &schema{Type: "object", AdditionalProperties: &schema{Type: "boolean"}},
+		"buttons":         &schema{Type: "object", AdditionalProperties: &schema{Type: "boolean"}},
+		"relays":          integer(0, 255),
+		"inputs":          integer(0, 255),
+		"system-error":    integer(0, 255),
+		"special-info":    integer(0, 255),
+		"sequence-no":     integer(0, 4294967295),
+		"event":           ref("Event"),
+	}),
+
+	"Time": object(map[string]*schema{
+		"controller": integer(1, 4294967295),
+		"datetime":   format("string", "date-time"),
+	}),
+
+	"SetTime": object(map[string]*schema{
+		"datetime": describe(format("string", "date-time"), "Controller date/time (YYYY-MM-DD HH:mm:ss), defaults to the current time"),
+	}),
+
+	"Listener": object(map[string]*schema{
+		"controller": integer(1, 4294967295),
+		"listener":   &schema{Type: "string", Example: "192.168.1.100:60001"},
+	}),
+
+	"SetListener": object(map[string]*schema{
+		"listener": &schema{Type: "string", Pattern: `^[0-9]{1,3}(\.[0-9]{1,3}){3}:[0-9]{1,5}$`, Example: "192.168.1.100:60001"},
+	}, "listener"),
+
+	"Door": object(map[string]*schema{
+		"controller": integer(1, 4294967295),
+		"door":       integer(1, 4),
+		"mode":       enum("normally-open", "normally-closed", "controlled"),
+		"delay":      integer(0, 255),
+	}),
+
+	"SetDoor": object(map[string]*schema{
+		"mode":  enum("normally-open", "normally-closed", "controlled"),
+		"delay": describe(integer(0, 255), "Door open delay (seconds)"),
+	}, "mode"),
+
+	"Cards": object(map[string]*schema{
+		"controller": integer(1, 4294967295),
+		"cards":      integer(0, 4294967295),
+	}),
+
+	"Card": object(map[string]*schema{
+		"controller": integer(1, 4294967295),
+		"card":       integer(0, 4294967295),
+		"start-date": format("string", "date"),
+		"end-date":   format("string", "date"),
+		"doors":      doors(),
+		"PIN":        &schema{Type: "string", Pattern: `^[0-9]{0,6}$`},
+	}),
+
+	"PutCard": object(map[string]*schema{
+		"start-date": format("string", "date"),
+		"end-date":   format("string", "date"),
+		"doors":      doors(),
+		"PIN":        describe(&schema{Type: "string", Pattern: `^[0-9]{0,6}$`}, "Card keypad PIN (0-999999), as a string"),
+	}, "start-date", "end-date"),
+
+	"EventIndex": object(map[string]*schema{
+		"controller": integer(1, 4294967295),
+		"index":      integer(0, 4294967295),
+	}),
+
+	"ControllerEvent": object(map[string]*schema{
+		"controller": integer(1, 4294967295),
+		"event":      ref("Event"),
+	}),
+
+	"Notification": object(map[string]*schema{
+		"id":         integer(0, 4294967295),
+		"controller": integer(0, 4294967295),
+		"raw":        describe(bytearray(), "Event as received from the controller"),
+		"event":      describe(ref("Status"), "Decoded event (omitted if the message is not a controller event)"),
+	}),
+
+	"ReverseRequests": object(map[string]*schema{
+		"requests": &schema{Type: "array", Items: object(map[string]*schema{
+			"ID":      integer(0, 4294967295),
+			"request": bytearray(),
+		})},
+	}),
+
+	"ReverseReply": object(map[string]*schema{
+		"ID":    describe(integer(0, 4294967295), "Request ID"),
+		"reply": describe(octets(), "UDP reply"),
+	}, "ID", "reply"),
+
+	"Result": object(map[string]*schema{
+		"controller": integer(1, 4294967295),
+		"succeeded":  &schema{Type: "boolean"},
+	}),
+}
+
+var parameters = map[string]*schema{
+	"controller": describe(integer(1, 4294967295), "Controller serial number"),
+	"door":       describe(integer(1, 4), "Door number"),
+	"card":       describe(integer(0, 4294967295), "Card number"),
+	"index":      describe(integer(0, 4294967295), "Event index"),
+}
+
+var statuses = map[int]string{
+	http.StatusNoContent:           "No content",
+	http.StatusBadRequest:          "Invalid request (the response body describes the error)",
+	http.StatusUnauthorized:        "Missing or invalid credentials",
+	http.StatusForbidden:           "Request not permitted by the authentication, ACL or CSRF rules",
+	http.StatusNotFound:            "Not found",
+	http.StatusInternalServerError: "Internal error or request cancelled",
+	http.StatusBadGateway:          "Invalid controller response",
+	http.StatusGatewayTimeout:      "No response from controller",
+}
+
+// openapi serves the OpenAPI document for the HTTP connector, generated from the endpoint table and
+// request/response schemas.
+func (h *httpd) openapi(w http.ResponseWriter, r *http.Request) {
+	paths := map[string]map[string]any{}
+
+	for _, e := range endpoints {
+		if !h.serves(e) {
+			continue
+		}
+
+		operation := map[string]any{
+			"summary":     e.summary,
+			"operationId": e.id,
+		}
+
+		params := []any{}
+		for _, p := range regexp.MustCompile(`\{([a-z]+)\}`).FindAllStringSubmatch(e.path, -1) {
+			params = append(params, map[string]any{
+				"name":     p[1],
+				"in":       "path",
+				"required": true,
+				"schema":   parameter(p[1]),
+			})
+		}
+
+		for k, v := range e.query {
+			params = append(params, map[string]any{
+				"name":   k,
+				"in":     "query",
+				"schema": v,
+			})
+		}
+
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if e.request != "" {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": ref(e.request)},
+				},
+			}
+		}
+
+		responses := map[string]any{}
+		if e.response == "" {
+			responses["204"] = map[string]any{"description": statuses[http.StatusNoContent]}
+		} else if e.array {
+			responses["200"] = map[string]any{
+				"description": "OK",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": &schema{Type: "array", Items: ref(e.response)}},
+				},
+			}
+		} else if e.stream {
+			responses["200"] = map[string]any{
+				"description": "OK",
+				"content": map[string]any{
+					"text/event-stream": map[string]any{"schema": ref(e.response)},
+				},
+			}
+		} else {
+			responses["200"] = map[string]any{
+				"description": "OK",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": ref(e.response)},
+				},
+			}
+		}
+
+		for _, code := range e.errors {
+			if code == http.StatusNoContent {
+				responses["204"] = map[string]any{"description": statuses[code]}
+				continue
+			}
+
+			responses[fmt.Sprintf("%v", code)] = map[string]any{
+				"description": statuses[code],
+				"content": map[string]any{
+					"text/plain": map[string]any{"schema": map[string]any{"type": "string"}},
+				},
+			}
+		}
+
+		if h.auth != nil {
+			responses["401"] = map[string]any{"description": statuses[http.StatusUnauthorized]}
+			responses["403"] = map[string]any{"description": statuses[http.StatusForbidden]}
+		}
+
+		operation["responses"] = responses
+
+		if paths[e.path] == nil {
+			paths[e.path] = map[string]any{}
+		}
+
+		paths[e.path][strings.ToLower(e.method)] = operation
+	}
+
+	doc := map[string]any{
+		"openapi": OPENAPI_VERSION,
+		"info": map[string]any{
+			"title":       "uhppoted-tunnel",
+			"description": "UHPPOTE UDP tunnel HTTP connector API",
+			"version":     core.VERSION,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+		},
+	}
+
+	if h.auth != nil {
+		doc["components"].(map[string]any)["securitySchemes"] = map[string]any{
+			"basic":  map[string]any{"type": "http", "scheme": "basic"},
+			"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+		}
+
+		doc["security"] = []any{
+			map[string]any{"basic": []string{}},
+			map[string]any{"bearer": []string{}},
+		}
+	}
+
+	h.reply(doc, w, acceptsGzip(r))
+}
+
+// serves returns true if the endpoint is available on the connector i.e. the /events endpoint is always
+// available, the reverse tunnel endpoints only on a reverse tunnel connector and the request endpoints
+// only on an IN connector.
+func (h *httpd) serves(e endpoint) bool {
+	switch e.kind {
+	case "events":
+		return true
+
+	case "reverse":
+		return h.reverse != nil
+
+	default:
+		return !h.out && h.reverse == nil
+	}
+}
+
+// decode validates a JSON request body against the named schema and unmarshals it into the body.
+func decode(blob []byte, name string, body any) error {
+	var v any
+
+	if len(bytes.TrimSpace(blob)) == 0 {
+		return fmt.Errorf("empty request body")
+	}
+
+	d := json.NewDecoder(bytes.NewReader(blob))
+	d.UseNumber()
+
+	if err := d.Decode(&v); err != nil {
+		return fmt.Errorf("invalid JSON (%v)", err)
+	} else if _, err := d.Token(); err != io.EOF {
+		return fmt.Errorf("invalid JSON (unexpected data after request body)")
+	}
+
+	if s, ok := schemas[name]; ok {
+		if err := s.validate(v, ""); err != nil {
+			return err
+		}
+	}
+
+	return json.Unmarshal(blob, body)
+}
+
+func (s *schema) validate(v any, path string) error {
+	field := path
+	if field == "" {
+		field = "request body"
+	}
+
+	if len(s.OneOf) > 0 {
+		types := []string{}
+		for _, o := range s.OneOf {
+			if o.accepts(v) {
+				return o.validate(v, path)
+			}
+
+			if strings.ContainsAny(o.Type[:1], "aeiou") {
+				types = append(types, "an "+o.Type)
+			} else {
+				types = append(types, "a "+o.Type)
+			}
+		}
+
+		return fmt.Errorf("%v must be %v (was %v)", field, strings.Join(types, " or "), kind(v))
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%v must be an object (was %v)", field, kind(v))
+		}
+
+		for _, k := range s.Required {
+			if _, ok := object[k]; !ok {
+				return fmt.Errorf("missing required field '%v'", join(path, k))
+			}
+		}
+
+		keys := []string{}
+		for k := range object {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if p, ok := s.Properties[k]; ok {
+				if err := p.validate(object[k], join(path, k)); err != nil {
+					return err
+				}
+			} else if p, ok := s.AdditionalProperties.(*schema); ok {
+				if err := p.validate(object[k], join(path, k)); err != nil {
+					return err
+				}
+			} else if b, ok := s.AdditionalProperties.(bool); ok && !b {
+				return fmt.Errorf("unknown field '%v'", join(path, k))
+			}
+		}
+
+	case "array":
+		array, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%v must be an array (was %v)", field, kind(v))
+		}
+
+		if s.MinItems != nil && len(array) < *s.MinItems {
+			return fmt.Errorf("%v must have at least %v items (has %v)", field, *s.MinItems, len(array))
+		}
+
+		if s.MaxItems != nil && len(array) > *s.MaxItems {
+			return fmt.Errorf("%v must have at most %v items (has %v)", field, *s.MaxItems, len(array))
+		}
+
+		if s.Items != nil {
+			for i, item := range array {
+				if err := s.Items.validate(item, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%v must be an integer (was %v)", field, kind(v))
+		}
+
+		i, err := strconv.ParseInt(n.String(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%v must be an integer (was %v)", field, n)
+		}
+
+		switch {
+		case s.Minimum != nil && s.Maximum != nil && (i < *s.Minimum || i > *s.Maximum):
+			return fmt.Errorf("%v must be in the range %v to %v (was %v)", field, *s.Minimum, *s.Maximum, i)
+
+		case s.Minimum != nil && i < *s.Minimum:
+			return fmt.Errorf("%v must be at least %v (was %v)", field, *s.Minimum, i)
+
+		case s.Maximum != nil && i > *s.Maximum:
+			return fmt.Errorf("%v must be at most %v (was %v)", field, *s.Maximum, i)
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%v must be true or false (was %v)", field, kind(v))
+		}
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%v must be a string (was %v)", field, kind(v))
+		}
+
+		if len(s.Enum) > 0 && !contains(s.Enum, str) {
+			return fmt.Errorf("%v must be one of %v (was '%v')", field, strings.Join(s.Enum, ", "), str)
+		}
+
+		if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(str) {
+			return fmt.Errorf("%v has an invalid format (was '%v')", field, str)
+		}
+
+		switch s.Format {
+		case "duration":
+			if _, err := time.ParseDuration(str); err != nil {
+				return fmt.Errorf("%v must be a duration e.g. 500ms, 5s (was '%v')", field, str)
+			}
+
+		case "date":
+			if _, err := time.Parse("2006-01-02", str); err != nil {
+				return fmt.Errorf("%v must be a date formatted as YYYY-MM-DD (was '%v')", field, str)
+			}
+
+		case "date-time":
+			if str != "" {
+				if _, err := time.Parse("2006-01-02 15:04:05", str); err == nil {
+					break
+				} else if _, err := time.Parse("2006-01-02 15:04:05 MST", str); err != nil {
+					return fmt.Errorf("%v must be a date/time formatted as YYYY-MM-DD HH:mm:ss (was '%v')", field, str)
+				}
+			}
+
+		case "byte":
+			if b, err := base64.StdEncoding.DecodeString(str); err != nil || len(b) == 0 {
+				return fmt.Errorf("%v must be a base64 encoded byte array (was '%v')", field, str)
+			}
+		}
+	}
+
+	return nil
+}
+
+// accepts returns true if the JSON value is the schema type.
+func (s *schema) accepts(v any) bool {
+	switch v.(type) {
+	case map[string]any:
+		return s.Type == "object"
+	case []any:
+		return s.Type == "array"
+	case json.Number:
+		return s.Type == "integer"
+	case bool:
+		return s.Type == "boolean"
+	case string:
+		return s.Type == "string"
+	default:
+		return false
+	}
+}
+
+func object(properties map[string]*schema, required ...string) *schema {
+	return &schema{
+		Type:       "object",
+		Properties: properties,
+		Required:   required,
+	}
+}
+
+func integer(min, max int64) *schema {
+	return &schema{
+		Type:    "integer",
+		Minimum: &min,
+		Maximum: &max,
+	}
+}
+
+func format(t, f string) *schema {
+	return &schema{
+		Type:   t,
+		Format: f,
+	}
+}
+
+func enum(values ...string) *schema {
+	return &schema{
+		Type: "string",
+		Enum: values,
+	}
+}
+
+func bytearray() *schema {
+	min := 1
+
+	return &schema{
+		Type:     "array",
+		Items:    integer(0, 255),
+		MinItems: &min,
+	}
+}
+
+// octets is the schema for a byte array in a request body, which is accepted either as an array of
+// bytes or as a base64 encoded string.
+func octets() *schema {
+	return &schema{
+		OneOf: []*schema{
+			bytearray(),
+			format("string", "byte"),
+		},
+	}
+}
+
+func doors() *schema {
+	return &schema{
+		Type:        "object",
+		Description: "Door access permissions (0: none, 1: always, 2-254: time profile)",
+		Properties: map[string]*schema{
+			"1": integer(0, 254),
+			"2": integer(0, 254),
+			"3": integer(0, 254),
+			"4": integer(0, 254),
+		},
+		AdditionalProperties: false,
+	}
+}
+
+func describe(s *schema, description string) *schema {
+	s.Description = description
+
+	return s
+}
+
+func parameter(name string) *schema {
+	if s, ok := parameters[name]; ok {
+		return s
+	}
+
+	return &schema{Type: "string"}
+}
+
+func ref(name string) *schema {
+	return &schema{
+		Ref: "#/components/schemas/" + name,
+	}
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+
+	return path + "." + field
+}
+
+func kind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		schema   string
+		body     string
+		expected []byte
+	}{
+		{"SendRequest", `{ "ID": 19, "request": [23, 148, 0, 0] }`, []byte{0x17, 0x94, 0x00, 0x00}},
+		{"SendRequest", `{ "ID": 19, "request": "F5QAAA==" }`, []byte{0x17, 0x94, 0x00, 0x00}},
+		{"BroadcastRequest", `{ "wait": "500ms", "request": [23, 148] }`, []byte{0x17, 0x94}},
+		{"ReverseReply", `{ "ID": 19, "reply": "F5Q=" }`, []byte{0x17, 0x94}},
+	}
+
+	for _, v := range tests {
+		body := struct {
+			Request []byte `json:"request"`
+			Reply   []byte `json:"reply"`
+		}{}
+
+		if err := decode([]byte(v.body), v.schema, &body); err != nil {
+			t.Errorf("%v: unexpected error (%v)", v.body, err)
+		} else if decoded := append(body.Request, body.Reply...); !reflect.DeepEqual(decoded, v.expected) {
+			t.Errorf("%v: incorrectly decoded - expected:%v, got:%v", v.body, v.expected, decoded)
+		}
+	}
+}
+
+func TestDecodeWithInvalidBody(t *testing.T) {
+	tests := []struct {
+		schema   string
+		body     string
+		expected string
+	}{
+		{"SendRequest", ``, "empty request body"},
+		{"SendRequest", `{ "ID": 19 }`, "missing required field 'request'"},
+		{"SendRequest", `{ "ID": -1, "request": [23] }`, "ID must be in the range 0 to 2147483647 (was -1)"},
+		{"SendRequest", `{ "ID": 2147483648, "request": [23] }`, "ID must be in the range 0 to 2147483647 (was 2147483648)"},
+		{"SendRequest", `{ "request": [23, 256] }`, "request[1] must be in the range 0 to 255 (was 256)"},
+		{"SendRequest", `{ "request": [] }`, "request must have at least 1 items (has 0)"},
+		{"SendRequest", `{ "request": "!!!" }`, "request must be a base64 encoded byte array (was '!!!')"},
+		{"SendRequest", `{ "request": 23 }`, "request must be an array or a string (was a number)"},
+		{"SendRequest", `{ "request": [23] } { }`, "invalid JSON (unexpected data after request body)"},
+		{"SendRequest", `{ "request": [23] `, "invalid JSON"},
+		{"BroadcastRequest", `{ "wait": "5 seconds", "request": [23] }`, "wait must be a duration e.g. 500ms, 5s (was '5 seconds')"},
+		{"PutCard", `{ "start-date": "2024-13-01", "end-date": "2024-12-31" }`, "start-date must be a date formatted as YYYY-MM-DD (was '2024-13-01')"},
+		{"PutCard", `{ "start-date": "2024-01-01", "end-date": "2024-12-31", "doors": { "5": 1 } }`, "unknown field 'doors.5'"},
+		{"PutCard", `{ "start-date": "2024-01-01", "end-date": "2024-12-31", "doors": { "1": 255 } }`, "doors.1 must be in the range 0 to 254 (was 255)"},
+		{"SetTime", `{ "datetime": "2024-01-01T12:34:56" }`, "datetime must be a date/time formatted as YYYY-MM-DD HH:mm:ss (was '2024-01-01T12:34:56')"},
+		{"SetDoor", `{ "mode": "open" }`, "mode must be one of normally-open, normally-closed, controlled (was 'open')"},
+		{"SetListener", `{ "listener": "192.168.1.100" }`, "listener has an invalid format (was '192.168.1.100')"},
+	}
+
+	for _, v := range tests {
+		body := map[string]any{}
+
+		if err := decode([]byte(v.body), v.schema, &body); err == nil {
+			t.Errorf("%v: expected error", v.body)
+		} else if !strings.HasPrefix(err.Error(), v.expected) {
+			t.Errorf("%v: incorrect error - expected:%v, got:%v", v.body, v.expected, err)
+		}
+	}
+}
+
+func TestValidateIntegerRange(t *testing.T) {
+	min := int64(1)
+	max := int64(4)
+
+	tests := []struct {
+		schema   schema
+		value    string
+		expected string
+	}{
+		{schema{Type: "integer", Minimum: &min, Maximum: &max}, "0", "door must be in the range 1 to 4 (was 0)"},
+		{schema{Type: "integer", Minimum: &min, Maximum: &max}, "5", "door must be in the range 1 to 4 (was 5)"},
+		{schema{Type: "integer", Minimum: &min}, "0", "door must be at least 1 (was 0)"},
+		{schema{Type: "integer", Maximum: &max}, "5", "door must be at most 4 (was 5)"},
+		{schema{Type: "integer", Minimum: &min}, "5", ""},
+		{schema{Type: "integer", Maximum: &max}, "0", ""},
+		{schema{Type: "integer"}, "-1", ""},
+	}
+
+	for _, v := range tests {
+		err := v.schema.validate(json.Number(v.value), "door")
+
+		switch {
+		case v.expected == "" && err != nil:
+			t.Errorf("%v: unexpected error (%v)", v.value, err)
+
+		case v.expected != "" && err == nil:
+			t.Errorf("%v: expected error", v.value)
+
+		case v.expected != "" && err.Error() != v.expected:
+			t.Errorf("%v: incorrect error - expected:%v, got:%v", v.value, v.expected, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Policy holds the CORS, CSRF and security header settings for the HTTP connectors.
+type Policy struct {
+	origins []string
+	methods []string
+	csrf    bool
+	csp     string
+}
+
+const CSRF_COOKIE = "uhppoted-tunnel-csrf"
+const CSRF_HEADER = "X-CSRF-Token"
+const DEFAULT_CSP = "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'"
+
+var DefaultMethods = []string{"GET", "POST", "PUT", "DELETE"}
+
+// NewPolicy creates the CORS/CSRF/security header policy. Origins and methods are comma or space
+// separated lists (TOML arrays are accepted as is), with an empty origins list disabling CORS.
+func NewPolicy(origins, methods string, csrf bool, csp string) *Policy {
+	p := Policy{
+		origins: split(origins),
+		methods: DefaultMethods,
+		csrf:    csrf,
+		csp:     strings.TrimSpace(csp),
+	}
+
+	if list := split(methods); len(list) > 0 {
+		p.methods = []string{}
+		for _, m := range list {
+			p.methods = append(p.methods, strings.ToUpper(m))
+		}
+	}
+
+	if p.csp == "" {
+		p.csp = DEFAULT_CSP
+	}
+
+	return &p
+}
+
+// secure wraps a handler with the security headers, CORS and CSRF checks. A nil policy applies
+// the default security headers only.
+func (h *httpd) secure(handler http.Handler) http.Handler {
+	p := h.policy
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		csp := DEFAULT_CSP
+		if p != nil {
+			csp = p.csp
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Content-Security-Policy", csp)
+
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		}
+
+		if p != nil {
+			if origin := r.Header.Get("Origin"); origin != "" {
+				w.Header().Add("Vary", "Origin")
+
+				if contains(p.origins, "*") {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else if p.allowed(origin) {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+
+				if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+					p.preflight(w, r, origin)
+					return
+				}
+			}
+
+			if p.csrf {
+				if err := p.verify(w, r); err != nil {
+					h.Warnf("%v %v from %v rejected (%v)", r.Method, r.URL.Path, r.RemoteAddr, err)
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (p *Policy) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+
+	if !p.allowed(origin) || !contains(p.methods, method) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", fmt.Sprintf("Content-Type, Authorization, %v", CSRF_HEADER))
+	w.Header().Set("Access-Control-Max-Age", "600")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verify implements 'double submit cookie' CSRF protection. Safe requests are issued a CSRF cookie
+// if they do not already have one and state changing requests must include the cookie value in the
+// X-CSRF-Token header. Requests authenticated with a bearer token are not vulnerable to CSRF because
+// the browser does not add the token automatically and are not checked.
+func (p *Policy) verify(w http.ResponseWriter, r *http.Request) error {
+	cookie, _ := r.Cookie(CSRF_COOKIE)
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		if cookie == nil || cookie.Value == "" {
+			if token, err := csrfToken(); err == nil {
+				http.SetCookie(w, &http.Cookie{
+					Name:     CSRF_COOKIE,
+					Value:    token,
+					Path:     "/",
+					Secure:   r.TLS != nil,
+					SameSite: http.SameSiteStrictMode,
+				})
+			}
+		}
+
+		return nil
+	}
+
+	if header := r.Header.Get("Authorization"); len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return nil
+	}
+
+	token := r.Header.Get(CSRF_HEADER)
+	if cookie == nil || token == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+		return fmt.Errorf("missing or invalid CSRF token")
+	}
+
+	return nil
+}
+
+func (p *Policy) allowed(origin string) bool {
+	for _, v := range p.origins {
+		if v == "*" || strings.EqualFold(v, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hosts returns the host names of the allowed origins, for the WebSocket origin check.
+func (p *Policy) hosts() []string {
+	hosts := []string{}
+
+	if p != nil {
+		for _, v := range p.origins {
+			if u, err := url.Parse(v); err == nil && u.Host != "" {
+				hosts = append(hosts, u.Host)
+			} else {
+				hosts = append(hosts, v)
+			}
+		}
+	}
+
+	return hosts
+}
+
+func csrfToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func split(s string) []string {
+	list := []string{}
+	for _, v := range regexp.MustCompile(`[\s,]+`).Split(strings.Trim(strings.TrimSpace(s), "[]"), -1) {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	h := httpd{Conn: conn.Conn{Tag: "HTTP"}}
+	w := serve(&h, httptest.NewRequest("GET", "/", nil))
+
+	expected := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "no-referrer",
+		"Content-Security-Policy": DEFAULT_CSP,
+	}
+
+	for k, v := range expected {
+		if header := w.Header().Get(k); header != v {
+			t.Errorf("incorrect %v header - expected:%v, got:%v", k, v, header)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	h := httpd{
+		Conn:   conn.Conn{Tag: "HTTP"},
+		policy: NewPolicy("https://portal.example.com", "POST", false, ""),
+	}
+
+	tests := []struct {
+		method  string
+		origin  string
+		request string
+		status  int
+		allowed string
+	}{
+		{"POST", "https://portal.example.com", "", http.StatusOK, "https://portal.example.com"},
+		{"POST", "https://evil.example.com", "", http.StatusOK, ""},
+		{"OPTIONS", "https://portal.example.com", "POST", http.StatusNoContent, "https://portal.example.com"},
+		{"OPTIONS", "https://portal.example.com", "DELETE", http.StatusForbidden, "https://portal.example.com"},
+		{"OPTIONS", "https://evil.example.com", "POST", http.StatusForbidden, ""},
+	}
+
+	for _, v := range tests {
+		r := httptest.NewRequest(v.method, "/udp/send", nil)
+		r.Header.Set("Origin", v.origin)
+		if v.request != "" {
+			r.Header.Set("Access-Control-Request-Method", v.request)
+		}
+
+		w := serve(&h, r)
+
+		if w.Code != v.status {
+			t.Errorf("%v %v: incorrect status - expected:%v, got:%v", v.method, v.origin, v.status, w.Code)
+		}
+
+		if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != v.allowed {
+			t.Errorf("%v %v: incorrect allowed origin - expected:%v, got:%v", v.method, v.origin, v.allowed, origin)
+		}
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	h := httpd{
+		Conn:   conn.Conn{Tag: "HTTP"},
+		policy: NewPolicy("", "", true, ""),
+	}
+
+	w := serve(&h, httptest.NewRequest("GET", "/", nil))
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == CSRF_COOKIE {
+			cookie = c
+		}
+	}
+
+	if cookie == nil || cookie.Value == "" {
+		t.Fatalf("CSRF cookie not issued for GET request")
+	}
+
+	tests := []struct {
+		cookie bool
+		token  string
+		bearer bool
+		status int
+	}{
+		{false, "", false, http.StatusForbidden},
+		{true, "", false, http.StatusForbidden},
+		{true, "qwerty", false, http.StatusForbidden},
+		{false, cookie.Value, false, http.StatusForbidden},
+		{true, cookie.Value, false, http.StatusOK},
+		{false, "", true, http.StatusOK},
+	}
+
+	for _, v := range tests {
+		r := httptest.NewRequest("POST", "/udp/send", nil)
+		if v.cookie {
+			r.AddCookie(cookie)
+		}
+
+		if v.token != "" {
+			r.Header.Set(CSRF_HEADER, v.token)
+		}
+
+		if v.bearer {
+			r.Header.Set("Authorization", "Bearer 0123456789abcdef")
+		}
+
+		if w := serve(&h, r); w.Code != v.status {
+			t.Errorf("cookie:%v token:'%v' bearer:%v - incorrect status - expected:%v, got:%v", v.cookie, v.token, v.bearer, v.status, w.Code)
+		}
+	}
+}
+
+func serve(h *httpd, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.secure(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(w, r)
+
+	return w
+}
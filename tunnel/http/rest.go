@@ -0,0 +1,817 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	codec "github.com/uhppoted/uhppote-core/encoding/UTO311-L0x"
+	"github.com/uhppoted/uhppote-core/messages"
+	"github.com/uhppoted/uhppote-core/types"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+)
+
+// REST API request and response bodies. The API builds the controller requests with the uhppote-core
+// codec, dispatches them through the router and returns the decoded responses as JSON.
+
+type device struct {
+	Controller uint32 `json:"controller"`
+	Address    string `json:"address"`
+	Netmask    string `json:"netmask"`
+	Gateway    string `json:"gateway"`
+	MAC        string `json:"MAC"`
+	Version    string `json:"version"`
+	Date       string `json:"date"`
+}
+
+type event struct {
+	Index     uint32         `json:"index"`
+	Type      uint8          `json:"type"`
+	Granted   bool           `json:"granted"`
+	Door      uint8          `json:"door"`
+	Direction uint8          `json:"direction"`
+	Card      uint32         `json:"card"`
+	Timestamp types.DateTime `json:"timestamp"`
+	Reason    uint8          `json:"reason"`
+}
+
+type status struct {
+	Controller  uint32         `json:"controller"`
+	SystemTime  string         `json:"system-datetime"`
+	Doors       map[uint8]bool `json:"doors"`
+	Buttons     map[uint8]bool `json:"buttons"`
+	Relays      uint8          `json:"relays"`
+	Inputs      uint8          `json:"inputs"`
+	SystemError uint8          `json:"system-error"`
+	SpecialInfo uint8          `json:"special-info"`
+	SequenceNo  uint32         `json:"sequence-no"`
+	Event       *event         `json:"event,omitempty"`
+}
+
+type card struct {
+	Controller uint32          `json:"controller"`
+	Card       uint32          `json:"card"`
+	StartDate  types.Date      `json:"start-date"`
+	EndDate    types.Date      `json:"end-date"`
+	Doors      map[uint8]uint8 `json:"doors"`
+	PIN        types.PIN       `json:"PIN"`
+}
+
+type door struct {
+	Controller uint32 `json:"controller"`
+	Door       uint8  `json:"door"`
+	Mode       string `json:"mode"`
+	Delay      uint8  `json:"delay"`
+}
+
+type result struct {
+	Controller uint32 `json:"controller"`
+	Succeeded  bool   `json:"succeeded"`
+}
+
+var modes = map[uint8]string{
+	1: "normally-open",
+	2: "normally-closed",
+	3: "controlled",
+}
+
+const MAGIC_WORD = 0x55aaaa55
+
+// endpoint describes an HTTP connector endpoint. The endpoints table is used to register the REST API
+// handlers and to generate the OpenAPI document.
+type endpoint struct {
+	id       string
+	kind     string
+	method   string
+	path     string
+	summary  string
+	query    map[string]*schema
+	request  string
+	response string
+	array    bool
+	stream   bool
+	errors   []int
+	handler  func(*httpd, http.ResponseWriter, *http.Request, *router.Switch)
+}
+
+var endpoints = []endpoint{
+	{
+		id:       "broadcast",
+		method:   http.MethodPost,
+		path:     "/udp/broadcast",
+		summary:  "Broadcasts a UDP request and returns the replies received within the 'wait' interval",
+		request:  "BroadcastRequest",
+		response: "BroadcastResponse",
+		errors:   []int{400, 403, 500},
+	},
+	{
+		id:       "send",
+		method:   http.MethodPost,
+		path:     "/udp/send",
+		summary:  "Sends a UDP request and returns the reply",
+		request:  "SendRequest",
+		response: "SendResponse",
+		errors:   []int{400, 403, 500},
+	},
+	{
+		id:       "events",
+		kind:     "events",
+		method:   http.MethodGet,
+		path:     "/events",
+		summary:  "Streams the received events as Server-Sent Events (or WebSocket messages if the request is a WebSocket upgrade)",
+		query:    map[string]*schema{"controller": describe(&schema{Type: "string", Example: "405419896,303986753"}, "Comma separated list of controllers (defaults to all controllers)")},
+		response: "Notification",
+		stream:   true,
+		errors:   []int{400},
+	},
+	{
+		id:       "poll",
+		kind:     "reverse",
+		method:   http.MethodGet,
+		path:     "/poll",
+		summary:  "Returns the requests queued for a reverse tunnel, waiting for a request until the 'wait' interval has elapsed (204 if there are no pending requests)",
+		query:    map[string]*schema{"wait": describe(format("string", "duration"), "Maximum time to wait for a request (default 30s, maximum 60s)")},
+		response: "ReverseRequests",
+		errors:   []int{204, 400},
+	},
+	{
+		id:      "reply",
+		kind:    "reverse",
+		method:  http.MethodPost,
+		path:    "/reply",
+		summary: "Returns a reply to a reverse tunnel request",
+		request: "ReverseReply",
+		errors:  []int{400, 404, 500},
+	},
+	{
+		id:       "get-controllers",
+		method:   http.MethodGet,
+		path:     "/controllers",
+		summary:  "Returns the controllers that replied to a get-device broadcast",
+		query:    map[string]*schema{"wait": describe(format("string", "duration"), "Time to wait for replies (default 2.5s)")},
+		response: "Device",
+		array:    true,
+		errors:   []int{400, 403, 500},
+		handler:  (*httpd).getDevices,
+	},
+	{
+		id:       "get-controller",
+		method:   http.MethodGet,
+		path:     "/controllers/{controller}",
+		summary:  "Returns the controller network configuration and firmware version",
+		response: "Device",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).getDevice,
+	},
+	{
+		id:       "get-status",
+		method:   http.MethodGet,
+		path:     "/controllers/{controller}/status",
+		summary:  "Returns the controller status",
+		response: "Status",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).getStatus,
+	},
+	{
+		id:       "get-time",
+		method:   http.MethodGet,
+		path:     "/controllers/{controller}/time",
+		summary:  "Returns the controller date and time",
+		response: "Time",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).getTime,
+	},
+	{
+		id:       "set-time",
+		method:   http.MethodPut,
+		path:     "/controllers/{controller}/time",
+		summary:  "Sets the controller date and time",
+		request:  "SetTime",
+		response: "Time",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).setTime,
+	},
+	{
+		id:       "get-listener",
+		method:   http.MethodGet,
+		path:     "/controllers/{controller}/listener",
+		summary:  "Returns the controller event listener address",
+		response: "Listener",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).getListener,
+	},
+	{
+		id:       "set-listener",
+		method:   http.MethodPut,
+		path:     "/controllers/{controller}/listener",
+		summary:  "Sets the controller event listener address",
+		request:  "SetListener",
+		response: "Result",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).setListener,
+	},
+	{
+		id:       "get-door",
+		method:   http.MethodGet,
+		path:     "/controllers/{controller}/doors/{door}",
+		summary:  "Returns the door control mode and delay",
+		response: "Door",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).getDoor,
+	},
+	{
+		id:       "set-door",
+		method:   http.MethodPut,
+		path:     "/controllers/{controller}/doors/{door}",
+		summary:  "Sets the door control mode and delay",
+		request:  "SetDoor",
+		response: "Door",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).setDoor,
+	},
+	{
+		id:       "open-door",
+		method:   http.MethodPost,
+		path:     "/controllers/{controller}/doors/{door}/open",
+		summary:  "Unlocks a door",
+		response: "Result",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).openDoor,
+	},
+	{
+		id:       "get-cards",
+		method:   http.MethodGet,
+		path:     "/controllers/{controller}/cards",
+		summary:  "Returns the number of cards stored on the controller",
+		response: "Cards",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).getCards,
+	},
+	{
+		id:       "delete-cards",
+		method:   http.MethodDelete,
+		path:     "/controllers/{controller}/cards",
+		summary:  "Deletes all cards from the controller",
+		response: "Result",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).deleteCards,
+	},
+	{
+		id:       "get-card",
+		method:   http.MethodGet,
+		path:     "/controllers/{controller}/cards/{card}",
+		summary:  "Returns a card record",
+		response: "Card",
+		errors:   []int{400, 403, 404, 502, 504},
+		handler:  (*httpd).getCard,
+	},
+	{
+		id:       "put-card",
+		method:   http.MethodPut,
+		path:     "/controllers/{controller}/cards/{card}",
+		summary:  "Adds or updates a card record",
+		request:  "PutCard",
+		response: "Result",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).putCard,
+	},
+	{
+		id:       "delete-card",
+		method:   http.MethodDelete,
+		path:     "/controllers/{controller}/cards/{card}",
+		summary:  "Deletes a card record",
+		response: "Result",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).deleteCard,
+	},
+	{
+		id:       "get-event-index",
+		method:   http.MethodGet,
+		path:     "/controllers/{controller}/events",
+		summary:  "Returns the controller event index",
+		response: "EventIndex",
+		errors:   []int{400, 403, 502, 504},
+		handler:  (*httpd).getEventIndex,
+	},
+	{
+		id:       "get-event",
+		method:   http.MethodGet,
+		path:     "/controllers/{controller}/events/{index}",
+		summary:  "Returns the event stored at the index",
+		response: "ControllerEvent",
+		errors:   []int{400, 403, 404, 502, 504},
+		handler:  (*httpd).getEvent,
+	},
+}
+
+func (h *httpd) api(mux *http.ServeMux, rs *router.Switch) {
+	for _, e := range endpoints {
+		if e.handler != nil {
+			f := e.handler
+			mux.HandleFunc(e.method+" "+e.path, h.authenticate(func(w http.ResponseWriter, r *http.Request) { f(h, w, r, rs) }))
+		}
+	}
+}
+
+func (h *httpd) getDevices(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	wait := 2500 * time.Millisecond
+	if v := r.URL.Query().Get("wait"); v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 || d > h.timeout {
+			http.Error(w, fmt.Sprintf("Invalid wait (%v)", v), http.StatusBadRequest)
+			return
+		} else {
+			wait = d
+		}
+	}
+
+	request, err := codec.Marshal(messages.GetDeviceRequest{})
+	if err != nil {
+		h.Warnf("%v", err)
+		http.Error(w, "Error encoding request", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.authorised(r, request); err != nil {
+		h.Warnf("%v", err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	id := protocol.NextID()
+	received := make(chan []byte, 16)
+	devices := []device{}
+	waited := time.After(wait)
+
+	h.DumpRequestf(request, "request %v  %v bytes from %v", id, len(request), r.RemoteAddr)
+
+	router.Received(id, request, func(reply []byte) {
+		select {
+		case received <- reply:
+		default:
+		}
+	})
+
+	for {
+		select {
+		case reply := <-received:
+			h.DumpReplyf(reply, "reply %v  %v bytes for %v", id, len(reply), r.RemoteAddr)
+
+			response := messages.GetDeviceResponse{}
+			if err := codec.Unmarshal(reply, &response); err != nil {
+				h.Warnf("%v", err)
+			} else {
+				devices = append(devices, makeDevice(response))
+			}
+
+		case <-h.ctx.Done():
+			http.Error(w, "Request cancelled", http.StatusInternalServerError)
+			return
+
+		case <-waited:
+			h.reply(devices, w, acceptsGzip(r))
+			return
+		}
+	}
+}
+
+func (h *httpd) getDevice(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); ok {
+		request := messages.GetDeviceRequest{SerialNumber: controller}
+		response := messages.GetDeviceResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(makeDevice(response), w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) getStatus(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); ok {
+		request := messages.GetStatusRequest{SerialNumber: controller}
+		response := messages.GetStatusResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			v := status{
+				Controller:  uint32(response.SerialNumber),
+				SystemTime:  fmt.Sprintf("%v %v", response.SystemDate, response.SystemTime),
+				Doors:       map[uint8]bool{1: response.Door1State, 2: response.Door2State, 3: response.Door3State, 4: response.Door4State},
+				Buttons:     map[uint8]bool{1: response.Door1Button, 2: response.Door2Button, 3: response.Door3Button, 4: response.Door4Button},
+				Relays:      response.RelayState,
+				Inputs:      response.InputState,
+				SystemError: response.SystemError,
+				SpecialInfo: response.SpecialInfo,
+				SequenceNo:  response.SequenceId,
+			}
+
+			if response.EventIndex != 0 {
+				v.Event = &event{
+					Index:     response.EventIndex,
+					Type:      response.EventType,
+					Granted:   response.Granted,
+					Door:      response.Door,
+					Direction: response.Direction,
+					Card:      response.CardNumber,
+					Timestamp: response.Timestamp,
+					Reason:    response.Reason,
+				}
+			}
+
+			h.reply(v, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) getTime(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); ok {
+		request := messages.GetTimeRequest{SerialNumber: controller}
+		response := messages.GetTimeResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(map[string]any{"controller": response.SerialNumber, "datetime": response.DateTime}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) setTime(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	body := struct {
+		DateTime types.DateTime `json:"datetime"`
+	}{}
+
+	if controller, ok := h.controller(w, r); !ok {
+		return
+	} else if !h.body(w, r, "SetTime", &body) {
+		return
+	} else {
+		if body.DateTime.IsZero() {
+			body.DateTime = types.DateTimeNow()
+		}
+
+		request := messages.SetTimeRequest{SerialNumber: controller, DateTime: body.DateTime}
+		response := messages.SetTimeResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(map[string]any{"controller": response.SerialNumber, "datetime": response.DateTime}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) getListener(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); ok {
+		request := messages.GetListenerRequest{SerialNumber: controller}
+		response := messages.GetListenerResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(map[string]any{"controller": response.SerialNumber, "listener": response.AddrPort.String()}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) setListener(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	body := struct {
+		Listener string `json:"listener"`
+	}{}
+
+	if controller, ok := h.controller(w, r); !ok {
+		return
+	} else if !h.body(w, r, "SetListener", &body) {
+		return
+	} else if listener, err := netip.ParseAddrPort(body.Listener); err != nil || !listener.Addr().Is4() {
+		http.Error(w, fmt.Sprintf("Invalid listener address (%v)", body.Listener), http.StatusBadRequest)
+	} else {
+		request := messages.SetListenerRequest{SerialNumber: controller, AddrPort: listener}
+		response := messages.SetListenerResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(result{Controller: uint32(response.SerialNumber), Succeeded: response.Succeeded}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) getDoor(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); !ok {
+		return
+	} else if d, ok := h.door(w, r); ok {
+		request := messages.GetDoorControlStateRequest{SerialNumber: controller, Door: d}
+		response := messages.GetDoorControlStateResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(door{
+				Controller: uint32(response.SerialNumber),
+				Door:       response.Door,
+				Mode:       modes[response.ControlState],
+				Delay:      response.Delay,
+			}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) setDoor(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	body := struct {
+		Mode  string `json:"mode"`
+		Delay uint8  `json:"delay"`
+	}{}
+
+	controller, ok := h.controller(w, r)
+	if !ok {
+		return
+	}
+
+	d, ok := h.door(w, r)
+	if !ok || !h.body(w, r, "SetDoor", &body) {
+		return
+	}
+
+	mode := uint8(0)
+	for k, v := range modes {
+		if strings.EqualFold(v, body.Mode) {
+			mode = k
+		}
+	}
+
+	if mode == 0 {
+		http.Error(w, fmt.Sprintf("Invalid door mode (%v)", body.Mode), http.StatusBadRequest)
+		return
+	}
+
+	request := messages.SetDoorControlStateRequest{SerialNumber: controller, Door: d, ControlState: mode, Delay: body.Delay}
+	response := messages.SetDoorControlStateResponse{}
+
+	if h.exec(w, r, router, request, &response) {
+		h.reply(door{
+			Controller: uint32(response.SerialNumber),
+			Door:       response.Door,
+			Mode:       modes[response.ControlState],
+			Delay:      response.Delay,
+		}, w, acceptsGzip(r))
+	}
+}
+
+func (h *httpd) openDoor(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); !ok {
+		return
+	} else if d, ok := h.door(w, r); ok {
+		request := messages.OpenDoorRequest{SerialNumber: controller, Door: d}
+		response := messages.OpenDoorResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(result{Controller: uint32(response.SerialNumber), Succeeded: response.Succeeded}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) getCards(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); ok {
+		request := messages.GetCardsRequest{SerialNumber: controller}
+		response := messages.GetCardsResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(map[string]any{"controller": response.SerialNumber, "cards": response.Records}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) deleteCards(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); ok {
+		request := messages.DeleteCardsRequest{SerialNumber: controller, MagicWord: MAGIC_WORD}
+		response := messages.DeleteCardsResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(result{Controller: uint32(response.SerialNumber), Succeeded: response.Succeeded}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) getCard(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); !ok {
+		return
+	} else if cardNumber, ok := h.uint32(w, r, "card"); ok {
+		request := messages.GetCardByIDRequest{SerialNumber: controller, CardNumber: cardNumber}
+		response := messages.GetCardByIDResponse{}
+
+		if !h.exec(w, r, router, request, &response) {
+			return
+		} else if response.CardNumber == 0 {
+			http.Error(w, fmt.Sprintf("Card %v not found", cardNumber), http.StatusNotFound)
+		} else {
+			h.reply(card{
+				Controller: uint32(response.SerialNumber),
+				Card:       response.CardNumber,
+				StartDate:  response.From,
+				EndDate:    response.To,
+				Doors:      map[uint8]uint8{1: response.Door1, 2: response.Door2, 3: response.Door3, 4: response.Door4},
+				PIN:        response.PIN,
+			}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) putCard(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	body := card{}
+
+	if controller, ok := h.controller(w, r); !ok {
+		return
+	} else if cardNumber, ok := h.uint32(w, r, "card"); !ok {
+		return
+	} else if !h.body(w, r, "PutCard", &body) {
+		return
+	} else if body.StartDate.IsZero() || body.EndDate.IsZero() {
+		http.Error(w, "Invalid card (missing start-date or end-date)", http.StatusBadRequest)
+	} else {
+		request := messages.PutCardRequest{
+			SerialNumber: controller,
+			CardNumber:   cardNumber,
+			From:         body.StartDate,
+			To:           body.EndDate,
+			Door1:        body.Doors[1],
+			Door2:        body.Doors[2],
+			Door3:        body.Doors[3],
+			Door4:        body.Doors[4],
+			PIN:          body.PIN,
+		}
+		response := messages.PutCardResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(result{Controller: uint32(response.SerialNumber), Succeeded: response.Succeeded}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) deleteCard(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); !ok {
+		return
+	} else if cardNumber, ok := h.uint32(w, r, "card"); ok {
+		request := messages.DeleteCardRequest{SerialNumber: controller, CardNumber: cardNumber}
+		response := messages.DeleteCardResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(result{Controller: uint32(response.SerialNumber), Succeeded: response.Succeeded}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) getEventIndex(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); ok {
+		request := messages.GetEventIndexRequest{SerialNumber: controller}
+		response := messages.GetEventIndexResponse{}
+
+		if h.exec(w, r, router, request, &response) {
+			h.reply(map[string]any{"controller": response.SerialNumber, "index": response.Index}, w, acceptsGzip(r))
+		}
+	}
+}
+
+func (h *httpd) getEvent(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	if controller, ok := h.controller(w, r); !ok {
+		return
+	} else if index, ok := h.uint32(w, r, "index"); ok {
+		request := messages.GetEventRequest{SerialNumber: controller, Index: index}
+		response := messages.GetEventResponse{}
+
+		if !h.exec(w, r, router, request, &response) {
+			return
+		} else if response.Index == 0 || response.Type == 0xff {
+			http.Error(w, fmt.Sprintf("Event %v not found", index), http.StatusNotFound)
+		} else {
+			h.reply(map[string]any{
+				"controller": response.SerialNumber,
+				"event": event{
+					Index:     response.Index,
+					Type:      response.Type,
+					Granted:   response.Granted,
+					Door:      response.Door,
+					Direction: response.Direction,
+					Card:      response.CardNumber,
+					Timestamp: response.Timestamp,
+					Reason:    response.Reason,
+				},
+			}, w, acceptsGzip(r))
+		}
+	}
+}
+
+// exec encodes and dispatches a request to a single controller and decodes the reply. Returns false
+// (after writing the error response) if the request could not be completed.
+func (h *httpd) exec(w http.ResponseWriter, r *http.Request, router *router.Switch, request any, response any) bool {
+	message, err := codec.Marshal(request)
+	if err != nil {
+		h.Warnf("%v", err)
+		http.Error(w, "Error encoding request", http.StatusInternalServerError)
+		return false
+	}
+
+	if err := h.authorised(r, message); err != nil {
+		h.Warnf("%v", err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+
+	id := protocol.NextID()
+	received := make(chan []byte, 1)
+	ctx, cancel := context.WithTimeout(h.ctx, h.timeout)
+
+	defer cancel()
+
+	h.DumpRequestf(message, "request %v  %v bytes from %v", id, len(message), r.RemoteAddr)
+
+	router.Received(id, message, func(reply []byte) {
+		select {
+		case received <- reply:
+		default:
+		}
+	})
+
+	select {
+	case reply := <-received:
+		h.DumpReplyf(reply, "reply %v  %v bytes for %v", id, len(reply), r.RemoteAddr)
+
+		if err := codec.Unmarshal(reply, response); err != nil {
+			h.Warnf("%v", err)
+			http.Error(w, "Invalid controller response", http.StatusBadGateway)
+			return false
+		}
+
+		return true
+
+	case <-ctx.Done():
+		h.Warnf("%v", ctx.Err())
+		http.Error(w, "No response from controller", http.StatusGatewayTimeout)
+		return false
+	}
+}
+
+func (h *httpd) controller(w http.ResponseWriter, r *http.Request) (types.SerialNumber, bool) {
+	if v, ok := h.uint32(w, r, "controller"); !ok {
+		return 0, false
+	} else if v == 0 {
+		http.Error(w, "Invalid controller (0)", http.StatusBadRequest)
+		return 0, false
+	} else {
+		return types.SerialNumber(v), true
+	}
+}
+
+func (h *httpd) door(w http.ResponseWriter, r *http.Request) (uint8, bool) {
+	if v, err := strconv.ParseUint(r.PathValue("door"), 10, 8); err != nil || v < 1 || v > 4 {
+		http.Error(w, fmt.Sprintf("Invalid door (%v)", r.PathValue("door")), http.StatusBadRequest)
+		return 0, false
+	} else {
+		return uint8(v), true
+	}
+}
+
+func (h *httpd) uint32(w http.ResponseWriter, r *http.Request, field string) (uint32, bool) {
+	if v, err := strconv.ParseUint(r.PathValue(field), 10, 32); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid %v (%v)", field, r.PathValue(field)), http.StatusBadRequest)
+		return 0, false
+	} else {
+		return uint32(v), true
+	}
+}
+
+func (h *httpd) body(w http.ResponseWriter, r *http.Request, name string, body any) bool {
+	if contentType := strings.ToLower(r.Header.Get("Content-Type")); !strings.HasPrefix(contentType, "application/json") {
+		http.Error(w, fmt.Sprintf("Invalid request content-type (%v)", contentType), http.StatusBadRequest)
+		return false
+	}
+
+	if blob, err := io.ReadAll(r.Body); err != nil {
+		h.Warnf("%v", err)
+		http.Error(w, "Error reading request", http.StatusInternalServerError)
+		return false
+	} else if err := decode(blob, name, body); err != nil {
+		h.Warnf("%v", err)
+		http.Error(w, fmt.Sprintf("Invalid request body (%v)", err), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func makeDevice(response messages.GetDeviceResponse) device {
+	return device{
+		Controller: uint32(response.SerialNumber),
+		Address:    response.IpAddress.String(),
+		Netmask:    response.SubnetMask.String(),
+		Gateway:    response.Gateway.String(),
+		MAC:        response.MacAddress.String(),
+		Version:    response.Version.String(),
+		Date:       response.Date.String(),
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		if strings.Contains(strings.ToLower(v), "gzip") {
+			return true
+		}
+	}
+
+	return false
+}
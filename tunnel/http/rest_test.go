@@ -0,0 +1,218 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/acl"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// controller is the stub OUT connector for the REST API tests. Requests are echoed back as the reply
+// (the request and response share the function code) with the 'succeeded' byte set, unless the
+// controller is offline.
+type controller struct {
+	router   router.Switch
+	requests atomic.Int32
+	offline  bool
+}
+
+func TestRESTRequestValidation(t *testing.T) {
+	tests := []struct {
+		method      string
+		path        string
+		contentType string
+		body        string
+		expected    string
+	}{
+		{"GET", "/controllers?wait=1h", "", "", "Invalid wait (1h)"},
+		{"GET", "/controllers?wait=-1s", "", "", "Invalid wait (-1s)"},
+		{"GET", "/controllers/0/status", "", "", "Invalid controller (0)"},
+		{"GET", "/controllers/qwerty/status", "", "", "Invalid controller (qwerty)"},
+		{"GET", "/controllers/4294967296/status", "", "", "Invalid controller (4294967296)"},
+		{"GET", "/controllers/405419896/doors/0", "", "", "Invalid door (0)"},
+		{"POST", "/controllers/405419896/doors/5/open", "", "", "Invalid door (5)"},
+		{"GET", "/controllers/405419896/cards/abc", "", "", "Invalid card (abc)"},
+		{"GET", "/controllers/405419896/events/-1", "", "", "Invalid index (-1)"},
+		{"PUT", "/controllers/405419896/time", "text/plain", `{}`, "Invalid request content-type (text/plain)"},
+		{"PUT", "/controllers/405419896/time", "application/json", `{ "datetime": "2024-01-01" }`, "Invalid request body (datetime must be a date/time"},
+		{"PUT", "/controllers/405419896/listener", "application/json", `{ "listener": "[::1]:60001" }`, "Invalid request body (listener has an invalid format"},
+		{"PUT", "/controllers/405419896/doors/1", "application/json", `{ "mode": "controlled", "delay": 256 }`, "Invalid request body (delay must be in the range"},
+		{"PUT", "/controllers/405419896/cards/10058400", "application/json", `{ "start-date": "2024-01-01" }`, "Invalid request body (missing required field 'end-date')"},
+	}
+
+	c := controller{}
+	h := httpd{
+		Conn:    conn.Conn{Tag: "HTTP"},
+		timeout: 250 * time.Millisecond,
+		ctx:     context.Background(),
+	}
+
+	mux := c.api(&h)
+
+	for _, v := range tests {
+		r := httptest.NewRequest(v.method, v.path, strings.NewReader(v.body))
+		if v.contentType != "" {
+			r.Header.Set("Content-Type", v.contentType)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%v %v: incorrect status - expected:%v, got:%v", v.method, v.path, http.StatusBadRequest, w.Code)
+		} else if body := w.Body.String(); !strings.HasPrefix(body, v.expected) {
+			t.Errorf("%v %v: incorrect error - expected:%v, got:%v", v.method, v.path, v.expected, body)
+		}
+	}
+
+	if n := c.requests.Load(); n != 0 {
+		t.Errorf("invalid requests dispatched to controller - expected:%v, got:%v", 0, n)
+	}
+}
+
+func TestRESTOpenDoor(t *testing.T) {
+	c := controller{}
+	h := httpd{
+		Conn:    conn.Conn{Tag: "HTTP"},
+		timeout: 1 * time.Second,
+		ctx:     context.Background(),
+	}
+
+	r := httptest.NewRequest("POST", "/controllers/405419896/doors/3/open", nil)
+	w := httptest.NewRecorder()
+
+	c.api(&h).ServeHTTP(w, r)
+
+	expected := result{Controller: 405419896, Succeeded: true}
+	response := result{}
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("incorrect status - expected:%v, got:%v (%v)", http.StatusOK, w.Code, w.Body.String())
+	} else if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response (%v)", err)
+	} else if !reflect.DeepEqual(response, expected) {
+		t.Errorf("incorrect response - expected:%v, got:%v", expected, response)
+	}
+}
+
+func TestRESTAccessControl(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "acl.toml")
+	if err := os.WriteFile(file, []byte(`
+[[identity]]
+identity = "CN=workshop"
+controllers = [ 405419896 ]
+functions = [ "get-status", "open-door" ]
+`), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	rules, err := acl.Load(file)
+	if err != nil {
+		t.Fatalf("error loading ACL (%v)", err)
+	}
+
+	workshop := x509.Certificate{Subject: pkix.Name{CommonName: "workshop"}}
+	admin := x509.Certificate{Subject: pkix.Name{CommonName: "admin"}}
+
+	tests := []struct {
+		method      string
+		path        string
+		certificate *x509.Certificate
+		status      int
+	}{
+		{"POST", "/controllers/405419896/doors/1/open", &workshop, http.StatusOK},
+		{"POST", "/controllers/303986753/doors/1/open", &workshop, http.StatusForbidden},
+		{"DELETE", "/controllers/405419896/cards", &workshop, http.StatusForbidden},
+		{"POST", "/controllers/405419896/doors/1/open", &admin, http.StatusForbidden},
+		{"POST", "/controllers/405419896/doors/1/open", nil, http.StatusForbidden},
+		{"GET", "/controllers", nil, http.StatusForbidden},
+	}
+
+	c := controller{}
+	h := httpd{
+		Conn:    conn.Conn{Tag: "HTTP"},
+		timeout: 1 * time.Second,
+		acl:     rules,
+		ctx:     context.Background(),
+	}
+
+	mux := c.api(&h)
+
+	for _, v := range tests {
+		r := httptest.NewRequest(v.method, v.path, nil)
+		if v.certificate != nil {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{v.certificate}}
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != v.status {
+			t.Errorf("%v %v: incorrect status - expected:%v, got:%v", v.method, v.path, v.status, w.Code)
+		}
+	}
+
+	if n := c.requests.Load(); n != 1 {
+		t.Errorf("incorrect number of requests dispatched to controller - expected:%v, got:%v", 1, n)
+	}
+}
+
+func TestRESTTimeout(t *testing.T) {
+	c := controller{offline: true}
+	h := httpd{
+		Conn:    conn.Conn{Tag: "HTTP"},
+		timeout: 100 * time.Millisecond,
+		ctx:     context.Background(),
+	}
+
+	mux := c.api(&h)
+
+	for _, path := range []string{"/controllers/405419896/status", "/controllers/405419896/cards/10058400"} {
+		r := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+
+		start := time.Now()
+		mux.ServeHTTP(w, r)
+		dt := time.Since(start)
+
+		if w.Code != http.StatusGatewayTimeout {
+			t.Errorf("%v: incorrect status - expected:%v, got:%v", path, http.StatusGatewayTimeout, w.Code)
+		} else if dt < h.timeout || dt > 10*h.timeout {
+			t.Errorf("%v: incorrect timeout - expected:%v, got:%v", path, h.timeout, dt)
+		}
+	}
+}
+
+// api returns the REST API handlers for h, dispatching requests to the stub controller.
+func (c *controller) api(h *httpd) *http.ServeMux {
+	c.router = router.NewSwitch(func(id uint32, message []byte) {
+		c.requests.Add(1)
+
+		if !c.offline {
+			reply := slices.Clone(message)
+			reply[8] = 0x01
+
+			c.router.Received(id, reply, nil)
+		}
+	})
+
+	mux := http.NewServeMux()
+	h.api(mux, &c.router)
+
+	return mux
+}
@@ -0,0 +1,225 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/auth"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/pki"
+)
+
+// queue holds the requests waiting to be collected by a long-polling http/poll connector. Requests that
+// are not collected within the request timeout are discarded. Collected requests are held as pending
+// until they are answered or expire, and replies are only accepted for pending requests.
+type queue struct {
+	requests chan queued
+	pending  map[uint32]pending
+	timeout  time.Duration
+	sync.Mutex
+}
+
+type queued struct {
+	id      uint32
+	message []byte
+	expires time.Time
+}
+
+type pending struct {
+	expires   time.Time
+	broadcast bool
+}
+
+type polled struct {
+	ID      uint32 `json:"ID"`
+	Request slice  `json:"request"`
+}
+
+const QUEUE_SIZE = 256
+const POLL_WAIT = 30 * time.Second
+const MAX_POLL_WAIT = 60 * time.Second
+const MAX_POLL_BATCH = 32
+
+// NewHTTPReverse creates an HTTP OUT connector for a reverse tunnel. Requests are queued for a remote
+// http/poll connector, which long-polls the /poll endpoint for pending requests and returns the replies
+// to the /reply endpoint.
+func NewHTTPReverse(spec string, html string, authentication *auth.Auth, policy *Policy, server *Server, timeout time.Duration, retry conn.Backoff, ctx context.Context) (*httpd, error) {
+	h, err := NewHTTP(spec, html, authentication, policy, server, retry, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	h.reverse = newQueue(timeout)
+
+	return h, nil
+}
+
+// NewHTTPSReverse creates an HTTPS OUT connector for a reverse tunnel.
+func NewHTTPSReverse(spec string, html string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, options *pki.Options, revocation *pki.Revocation, certificates *pki.ACME, authentication *auth.Auth, policy *Policy, server *Server, timeout time.Duration, retry conn.Backoff, ctx context.Context) (*https, error) {
+	h, err := NewHTTPS(spec, html, ca, keypair, requireClientCertificate, options, revocation, nil, certificates, authentication, policy, server, retry, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	h.reverse = newQueue(timeout)
+
+	return h, nil
+}
+
+func newQueue(timeout time.Duration) *queue {
+	return &queue{
+		requests: make(chan queued, QUEUE_SIZE),
+		pending:  map[uint32]pending{},
+		timeout:  timeout,
+	}
+}
+
+func (q *queue) push(id uint32, message []byte) error {
+	select {
+	case q.requests <- queued{id: id, message: message, expires: time.Now().Add(q.timeout)}:
+		return nil
+
+	default:
+		return fmt.Errorf("request queue full - discarding request %v", id)
+	}
+}
+
+// collected records a request handed out to an http/poll connector as pending.
+func (q *queue) collected(rq queued) {
+	broadcast := len(rq.message) < 8 || binary.LittleEndian.Uint32(rq.message[4:8]) == 0
+
+	q.Lock()
+	defer q.Unlock()
+
+	q.pending[rq.id] = pending{
+		expires:   rq.expires,
+		broadcast: broadcast,
+	}
+}
+
+// answered returns true if the reply is for a pending request. A request to a single controller is
+// no longer pending once it has been answered, whereas a broadcast request is pending (for the replies
+// from the other controllers) until it expires.
+func (q *queue) answered(id uint32) bool {
+	now := time.Now()
+
+	q.Lock()
+	defer q.Unlock()
+
+	for k, v := range q.pending {
+		if now.After(v.expires) {
+			delete(q.pending, k)
+		}
+	}
+
+	if p, ok := q.pending[id]; !ok {
+		return false
+	} else if !p.broadcast {
+		delete(q.pending, id)
+	}
+
+	return true
+}
+
+// poll returns the pending requests for a /poll request, waiting for at least one request until the
+// wait time has elapsed.
+func (h *httpd) poll(w http.ResponseWriter, r *http.Request) {
+	wait := POLL_WAIT
+	if v := r.URL.Query().Get("wait"); v != "" {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 || d > MAX_POLL_WAIT {
+			http.Error(w, fmt.Sprintf("Invalid wait (%v)", v), http.StatusBadRequest)
+			return
+		} else {
+			wait = d
+		}
+	}
+
+	h.extend(w, wait+EVENTS_WRITE_TIMEOUT)
+
+	requests := []polled{}
+	timer := time.NewTimer(wait)
+
+	defer timer.Stop()
+
+	take := func(rq queued) {
+		if time.Now().After(rq.expires) {
+			h.Warnf("request %v expired before it was collected", rq.id)
+		} else {
+			requests = append(requests, polled{ID: rq.id, Request: rq.message})
+			h.reverse.collected(rq)
+		}
+	}
+
+	for len(requests) == 0 {
+		select {
+		case rq := <-h.reverse.requests:
+			take(rq)
+
+		case <-timer.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+
+		case <-r.Context().Done():
+			return
+
+		case <-h.ctx.Done():
+			http.Error(w, "Closing", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+loop:
+	for len(requests) < MAX_POLL_BATCH {
+		select {
+		case rq := <-h.reverse.requests:
+			take(rq)
+
+		default:
+			break loop
+		}
+	}
+
+	h.Debugf("%v requests collected by %v", len(requests), r.RemoteAddr)
+
+	response := struct {
+		Requests []polled `json:"requests"`
+	}{
+		Requests: requests,
+	}
+
+	h.reply(response, w, acceptsGzip(r))
+}
+
+// replied relays a reply posted to /reply by the http/poll connector to the router. Replies that are
+// not for a pending request are rejected.
+func (h *httpd) replied(w http.ResponseWriter, r *http.Request, router *router.Switch) {
+	body := struct {
+		ID    uint32 `json:"ID"`
+		Reply []byte `json:"reply"`
+	}{}
+
+	if blob, err := io.ReadAll(r.Body); err != nil {
+		h.Warnf("%v", err)
+		http.Error(w, "Error reading request", http.StatusInternalServerError)
+	} else if err := decode(blob, "ReverseReply", &body); err != nil {
+		h.Warnf("%v", err)
+		http.Error(w, fmt.Sprintf("Invalid request body (%v)", err), http.StatusBadRequest)
+	} else if !h.reverse.answered(body.ID) {
+		h.Warnf("reply %v from %v rejected (no pending request)", body.ID, r.RemoteAddr)
+		http.Error(w, fmt.Sprintf("No pending request %v", body.ID), http.StatusNotFound)
+	} else {
+		h.DumpReplyf(body.Reply, "reply %v  %v bytes from %v", body.ID, len(body.Reply), r.RemoteAddr)
+
+		router.Received(body.ID, body.Reply, nil)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/auth"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+const TOKEN = "0123456789abcdef"
+
+func TestQueuePending(t *testing.T) {
+	q := newQueue(100 * time.Millisecond)
+
+	unicast := queued{id: 1, message: eventMessage(405419896), expires: time.Now().Add(q.timeout)}
+	broadcast := queued{id: 2, message: eventMessage(0), expires: time.Now().Add(q.timeout)}
+
+	q.collected(unicast)
+	q.collected(broadcast)
+
+	tests := []struct {
+		id       uint32
+		answered bool
+	}{
+		{1, true},
+		{1, false},
+		{2, true},
+		{2, true},
+		{3, false},
+	}
+
+	for _, v := range tests {
+		if answered := q.answered(v.id); answered != v.answered {
+			t.Errorf("request %v: incorrect answered - expected:%v, got:%v", v.id, v.answered, answered)
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if q.answered(2) {
+		t.Errorf("reply accepted for expired broadcast request")
+	}
+
+	if n := len(q.pending); n != 0 {
+		t.Errorf("expired requests not removed - expected:%v, got:%v", 0, n)
+	}
+}
+
+func TestReverse(t *testing.T) {
+	var relayed []uint32
+	var mutex sync.Mutex
+
+	sw := router.NewSwitch(func(id uint32, message []byte) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		relayed = append(relayed, id)
+	})
+
+	server := reverse(t, &sw)
+
+	unicast := protocol.NextID()
+	broadcast := protocol.NextID()
+	reply := func(id uint32) string {
+		return fmt.Sprintf(`{ "ID": %v, "reply": [23, 148] }`, id)
+	}
+
+	// ... unauthenticated and invalid requests
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{"GET", "/poll?wait=100ms", "", "", http.StatusUnauthorized},
+		{"POST", "/reply", "", reply(unicast), http.StatusForbidden},
+		{"GET", "/poll?wait=1h", TOKEN, "", http.StatusBadRequest},
+		{"GET", "/poll?wait=100ms", TOKEN, "", http.StatusNoContent},
+	}
+
+	for _, v := range tests {
+		if rs := server.do(t, v.method, v.path, v.token, v.body); rs.StatusCode != v.status {
+			t.Errorf("%v %v: incorrect status - expected:%v, got:%v", v.method, v.path, v.status, rs.StatusCode)
+		}
+	}
+
+	// ... poll
+	server.h.Send(unicast, eventMessage(405419896))
+	server.h.Send(broadcast, eventMessage(0))
+
+	response := struct {
+		Requests []polled `json:"requests"`
+	}{}
+
+	if rs := server.do(t, "GET", "/poll?wait=100ms", TOKEN, ""); rs.StatusCode != http.StatusOK {
+		t.Fatalf("incorrect poll status - expected:%v, got:%v", http.StatusOK, rs.StatusCode)
+	} else if err := json.NewDecoder(rs.Body).Decode(&response); err != nil {
+		t.Fatalf("invalid poll response (%v)", err)
+	} else if len(response.Requests) != 2 || response.Requests[0].ID != unicast || response.Requests[1].ID != broadcast {
+		t.Fatalf("incorrect polled requests - expected:%v, got:%v", []uint32{unicast, broadcast}, response.Requests)
+	}
+
+	// ... replies
+	replies := []struct {
+		body   string
+		status int
+	}{
+		{reply(19), http.StatusNotFound},
+		{reply(unicast), http.StatusNoContent},
+		{reply(unicast), http.StatusNotFound},
+		{reply(broadcast), http.StatusNoContent},
+		{reply(broadcast), http.StatusNoContent},
+	}
+
+	for _, v := range replies {
+		if rs := server.do(t, "POST", "/reply", TOKEN, v.body); rs.StatusCode != v.status {
+			t.Errorf("%v: incorrect status - expected:%v, got:%v", v.body, v.status, rs.StatusCode)
+		}
+	}
+
+	expected := []uint32{unicast, broadcast, broadcast}
+	deadline := time.Now().Add(1 * time.Second)
+
+	for time.Now().Before(deadline) {
+		mutex.Lock()
+		n := len(relayed)
+		mutex.Unlock()
+
+		if n >= len(expected) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	slices.Sort(relayed)
+	if !slices.Equal(relayed, expected) {
+		t.Errorf("incorrect replies relayed - expected:%v, got:%v", expected, relayed)
+	}
+}
+
+type reverseServer struct {
+	*httptest.Server
+	h *httpd
+}
+
+// reverse starts a reverse tunnel HTTP server with bearer token authentication and CSRF protection.
+func reverse(t *testing.T, sw *router.Switch) reverseServer {
+	file := filepath.Join(t.TempDir(), "auth.toml")
+	if err := os.WriteFile(file, []byte(fmt.Sprintf("[[token]]\nname = \"site\"\ntoken = \"%v\"\n", TOKEN)), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	authentication, err := auth.Load(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h := httpd{
+		Conn:    conn.Conn{Tag: "HTTP"},
+		auth:    authentication,
+		policy:  NewPolicy("", "", true, ""),
+		server:  NewServer(0, 0, 0, 0, 0),
+		reverse: newQueue(1 * time.Second),
+		ctx:     ctx,
+	}
+
+	server := httptest.NewServer(h.mux(sw))
+
+	t.Cleanup(func() {
+		cancel()
+		server.Close()
+	})
+
+	return reverseServer{server, &h}
+}
+
+func (s reverseServer) do(t *testing.T, method, path, token, body string) *http.Response {
+	rq, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	rq.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		rq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rs, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		t.Fatalf("%v %v: %v", method, path, err)
+	}
+
+	t.Cleanup(func() { rs.Body.Close() })
+
+	return rs
+}
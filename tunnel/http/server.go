@@ -0,0 +1,137 @@
+package http
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Server holds the HTTP/2 and timeout settings for the HTTP connector servers. Zero values are replaced
+// by the defaults.
+type Server struct {
+	readTimeout   time.Duration
+	writeTimeout  time.Duration
+	idleTimeout   time.Duration
+	headerTimeout time.Duration
+	maxStreams    uint32
+}
+
+const READ_TIMEOUT = 30 * time.Second
+const WRITE_TIMEOUT = 60 * time.Second
+const IDLE_TIMEOUT = 120 * time.Second
+const HEADER_TIMEOUT = 10 * time.Second
+const MAX_CONCURRENT_STREAMS = 250
+
+// NewServer creates the HTTP server settings, replacing zero values with the defaults.
+func NewServer(read, write, idle, header time.Duration, maxStreams uint32) *Server {
+	s := Server{
+		readTimeout:   READ_TIMEOUT,
+		writeTimeout:  WRITE_TIMEOUT,
+		idleTimeout:   IDLE_TIMEOUT,
+		headerTimeout: HEADER_TIMEOUT,
+		maxStreams:    MAX_CONCURRENT_STREAMS,
+	}
+
+	if read > 0 {
+		s.readTimeout = read
+	}
+
+	if write > 0 {
+		s.writeTimeout = write
+	}
+
+	if idle > 0 {
+		s.idleTimeout = idle
+	}
+
+	if header > 0 {
+		s.headerTimeout = header
+	}
+
+	if maxStreams > 0 {
+		s.maxStreams = maxStreams
+	}
+
+	return &s
+}
+
+// newServer creates the http.Server for a connector. Plain HTTP connectors accept HTTP/2 without TLS
+// (h2c, either by prior knowledge or an HTTP/1.1 upgrade) and HTTPS connectors negotiate HTTP/2 with
+// ALPN, unless the TLS ALPN protocols have been configured explicitly without 'h2'.
+func (h *httpd) newServer(handler http.Handler, config *tls.Config) (*http.Server, error) {
+	s := h.server
+	srv := http.Server{
+		Addr:              fmt.Sprintf("%v", h.addr),
+		Handler:           handler,
+		ReadTimeout:       s.readTimeout,
+		WriteTimeout:      s.writeTimeout,
+		IdleTimeout:       s.idleTimeout,
+		ReadHeaderTimeout: s.headerTimeout,
+	}
+
+	h2 := http2.Server{
+		MaxConcurrentStreams: s.maxStreams,
+		IdleTimeout:          s.idleTimeout,
+	}
+
+	if config == nil {
+		srv.Handler = h2c.NewHandler(handler, &h2)
+
+		return &srv, nil
+	}
+
+	srv.TLSConfig = config
+
+	if protocols := alpn(config.NextProtos); len(protocols) == 0 {
+		config.NextProtos = append([]string{http2.NextProtoTLS, "http/1.1"}, config.NextProtos...)
+	} else if !slices.Contains(protocols, http2.NextProtoTLS) {
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+
+		return &srv, nil
+	}
+
+	if err := http2.ConfigureServer(&srv, &h2); err != nil {
+		return nil, err
+	}
+
+	return &srv, nil
+}
+
+// extend resets the read and write deadlines for long-lived requests (event streams, long polls and
+// broadcasts that wait longer than the server timeouts). A zero duration clears the deadlines.
+func (h *httpd) extend(w http.ResponseWriter, d time.Duration) {
+	rc := http.NewResponseController(w)
+	deadline := time.Time{}
+
+	if d > 0 {
+		if d <= h.server.readTimeout && d <= h.server.writeTimeout {
+			return
+		}
+
+		deadline = time.Now().Add(d)
+	}
+
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		h.Debugf("%v", err)
+	} else if err := rc.SetWriteDeadline(deadline); err != nil {
+		h.Debugf("%v", err)
+	}
+}
+
+// alpn returns the configured ALPN protocols, excluding the protocol used for the ACME TLS-ALPN-01
+// challenge.
+func alpn(protocols []string) []string {
+	list := []string{}
+	for _, p := range protocols {
+		if p != "acme-tls/1" {
+			list = append(list, p)
+		}
+	}
+
+	return list
+}
@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/netip"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -22,12 +23,20 @@ type ipOut struct {
 	broadcastAddr *net.UDPAddr
 	timeout       time.Duration
 	controllers   map[uint32]any
+	settings      map[uint32]conn.Controller
+	retries       int
+	learned       *learned
+	pool          *pool
 	ctx           context.Context
 	ch            chan protocol.Message
 	closed        chan struct{}
 }
 
-func NewIPOut(hwif string, spec string, controllers map[uint32]string, timeout time.Duration, ctx context.Context) (*ipOut, error) {
+// NewIPOut creates an IP OUT connector that broadcasts requests to controllers that are not in the
+// controllers table and have not been learned from the replies to a get-device broadcast. The learned
+// controller addresses are persisted to the 'learned' file if it is not blank. Idempotent UDP requests
+// are resent up to 'retries' times within the request timeout.
+func NewIPOut(hwif string, spec string, controllers map[uint32]conn.Controller, learned string, timeout time.Duration, retries int, ctx context.Context) (*ipOut, error) {
 	broadcast, err := net.ResolveUDPAddr("udp", spec)
 	if err != nil {
 		return nil, err
@@ -49,14 +58,26 @@ func NewIPOut(hwif string, spec string, controllers map[uint32]string, timeout t
 		broadcastAddr: broadcast,
 		timeout:       timeout,
 		controllers:   map[uint32]any{},
+		settings:      controllers,
+		retries:       retries,
+		pool:          newPool(TCP_IDLE_TIMEOUT),
 		ctx:           ctx,
 		ch:            make(chan protocol.Message),
 		closed:        make(chan struct{}),
 	}
 
+	l, err := newLearned(learned)
+	if err != nil {
+		ip.Warnf("error loading learned controller addresses from %v (%v)", learned, err)
+	}
+
+	ip.learned = l
+
 	for k, v := range controllers {
-		if addr, err := resolve(v); err != nil {
-			ip.Warnf("invalid controller address '%v' (%v)", v, err)
+		if v.Address == "" {
+			continue
+		} else if addr, err := resolve(v.Address); err != nil {
+			ip.Warnf("invalid controller address '%v' (%v)", v.Address, err)
 		} else {
 			ip.controllers[k] = addr
 		}
@@ -81,17 +102,26 @@ func (ip *ipOut) Close() {
 }
 
 func (ip *ipOut) Run(router *router.Switch) error {
+	idle := time.NewTicker(ip.pool.idle / 2)
+
+	defer idle.Stop()
+
 loop:
 	for {
 		select {
 		case msg := <-ip.ch:
 			router.Received(msg.ID, msg.Message, nil)
 
+		case <-idle.C:
+			ip.pool.expire()
+
 		case <-ip.ctx.Done():
 			break loop
 		}
 	}
 
+	ip.pool.close()
+
 	close(ip.closed)
 
 	return nil
@@ -103,6 +133,10 @@ func (ip *ipOut) Send(id uint32, msg []byte) {
 	}()
 }
 
+// send sends a request to the controller address from the controllers table, or the learned address if
+// the controller is not in the table, and broadcasts the request otherwise. A learned address is forgotten
+// (and the request broadcast) if the controller does not reply. set-IP requests are always broadcast
+// because the controller does not reply and the address is going to change.
 func (ip *ipOut) send(id uint32, message []byte) {
 	if len(message) == 64 && message[0] == 0x17 {
 		controller := binary.LittleEndian.Uint32(message[4:])
@@ -118,15 +152,39 @@ func (ip *ipOut) send(id uint32, message []byte) {
 				return
 			}
 		}
+
+		if message[1] == 0x96 {
+			if err := ip.learned.forget(controller); err != nil {
+				ip.Warnf("%v", err)
+			}
+		} else if addr, ok := ip.learned.get(controller); ok {
+			if ip.udpSendto(id, message, addr) {
+				return
+			}
+
+			ip.Infof("controller %v not responding at learned address %v", controller, addr)
+
+			if err := ip.learned.forget(controller); err != nil {
+				ip.Warnf("%v", err)
+			}
+
+			// ... rebroadcasting a non-idempotent request could execute it twice
+			if !protocol.IsIdempotent(message[1]) {
+				ip.Warnf("request %v  %v not rebroadcast (not idempotent)", id, protocol.FunctionName(message[1]))
+				return
+			}
+		}
 	}
 
 	ip.broadcast(id, message)
 }
 
-func (ip *ipOut) udpSendto(id uint32, message []byte, addr *net.UDPAddr) {
-	ip.Dumpf(message, "udp/sendto (%v bytes)", len(message))
+// udpSendto sends a request directly to a controller and returns true if the controller replied.
+// Idempotent requests are resent if the controller has not replied within the attempt timeout.
+func (ip *ipOut) udpSendto(id uint32, message []byte, addr *net.UDPAddr) bool {
+	ip.DumpRequestf(message, "udp/sendto (%v bytes)", len(message))
 
-	deadline := time.Now().Add(ip.timeout)
+	timeout := conn.Timeout(message, ip.settings, ip.timeout)
 	address := fmt.Sprintf("%v", addr)
 	bind := &net.UDPAddr{
 		IP:   net.IPv4(0, 0, 0, 0),
@@ -135,7 +193,7 @@ func (ip *ipOut) udpSendto(id uint32, message []byte, addr *net.UDPAddr) {
 	}
 
 	dialer := net.Dialer{
-		Deadline:  deadline,
+		Deadline:  time.Now().Add(timeout),
 		LocalAddr: bind,
 		Control: func(network, address string, connection syscall.RawConn) (err error) {
 			var operr error
@@ -159,112 +217,69 @@ func (ip *ipOut) udpSendto(id uint32, message []byte, addr *net.UDPAddr) {
 	} else {
 		defer connection.Close()
 
-		if err := connection.SetDeadline(deadline); err != nil {
-			ip.Warnf("%v", err)
-		}
-
-		// if err := connection.SetWriteDeadline(deadline); err != nil {
-		// 	ip.Warnf("%v", err)
-		// }
-
-		// if err := connection.SetReadDeadline(deadline); err != nil {
-		// 	ip.Warnf("%v", err)
-		// }
+		attempts := conn.Attempts(message, ip.retries, timeout)
+		for i, wait := range attempts {
+			if i > 0 {
+				ip.Debugf("request %v  no reply - retrying (%v of %v)", id, i, len(attempts)-1)
+			}
 
-		if N, err := connection.Write(message); err != nil {
-			ip.Warnf("failed to write to UDP socket (%v)", err)
-		} else {
-			ip.Debugf("sent     %v bytes to %v\n", N, address)
+			if err := connection.SetDeadline(time.Now().Add(wait)); err != nil {
+				ip.Warnf("%v", err)
+			}
 
-			// NTS: set-ip doesn't return a reply
-			// if message[1] == 0x96 {
-			// 	return
-			// }
+			if N, err := connection.Write(message); err != nil {
+				ip.Warnf("failed to write to UDP socket (%v)", err)
+				return false
+			} else {
+				ip.Debugf("sent     %v bytes to %v\n", N, address)
+			}
 
 			reply := make([]byte, 2048)
 
 			if N, err := connection.Read(reply); err != nil {
+				var nerr net.Error
+				if errors.As(err, &nerr) && nerr.Timeout() && i+1 < len(attempts) {
+					continue
+				}
+
 				ip.Warnf("%v", err)
+				return false
 			} else {
-				ip.Dumpf(reply[0:N], "received %v bytes from %v", N, address)
+				ip.DumpReplyf(reply[0:N], "received %v bytes from %v", N, address)
 
 				ip.ch <- protocol.Message{
 					ID:      id,
 					Message: reply[:N],
 				}
+
+				return true
 			}
 		}
 	}
+
+	return false
 }
 
+// tcpSendto sends a request to a controller over the controller's pooled TCP connection.
 func (ip *ipOut) tcpSendto(id uint32, message []byte, addr *net.TCPAddr) {
-	ip.Dumpf(message, "tcp/sendto (%v bytes)", len(message))
-
-	deadline := time.Now().Add(ip.timeout)
-	address := fmt.Sprintf("%v", addr)
-	bind := &net.TCPAddr{
-		IP:   net.IPv4(0, 0, 0, 0),
-		Port: 0,
-		Zone: "",
-	}
-
-	dialer := net.Dialer{
-		Deadline:  deadline,
-		LocalAddr: bind,
-		Control: func(network, address string, connection syscall.RawConn) (err error) {
-			var operr error
-
-			f := func(fd uintptr) {
-				operr = setSocketOptions(fd)
-			}
+	ip.DumpRequestf(message, "tcp/sendto (%v bytes)", len(message))
 
-			if err := connection.Control(f); err != nil {
-				return err
-			} else {
-				return operr
-			}
-		},
-	}
+	deadline := time.Now().Add(conn.Timeout(message, ip.settings, ip.timeout))
 
-	if connection, err := dialer.Dial("tcp4", address); err != nil {
+	if reply, err := ip.pool.get(addr).exchange(message, deadline); err != nil {
 		ip.Warnf("%v", err)
-	} else if connection == nil {
-		ip.Warnf("invalid TCP socket (%v)", connection)
 	} else {
-		defer connection.Close()
+		ip.DumpReplyf(reply, "received %v bytes from %v", len(reply), addr)
 
-		if err := connection.SetDeadline(deadline); err != nil {
-			ip.Warnf("%v", err)
-		}
-
-		if N, err := connection.Write(message); err != nil {
-			ip.Warnf("failed to write to TCP socket [%v]", err)
-		} else {
-			ip.Debugf("sent     %v bytes to %v\n", N, address)
-
-			// // NTS: set-ip doesn't return a reply
-			// if message[1] == 0x96 {
-			// 	return
-			// }
-
-			reply := make([]byte, 1024)
-
-			if N, err := connection.Read(reply); err != nil {
-				ip.Warnf("%v", err)
-			} else {
-				ip.Dumpf(reply[0:N], "received %v bytes from %v", N, address)
-
-				ip.ch <- protocol.Message{
-					ID:      id,
-					Message: reply[:N],
-				}
-			}
+		ip.ch <- protocol.Message{
+			ID:      id,
+			Message: reply,
 		}
 	}
 }
 
 func (ip *ipOut) broadcast(id uint32, message []byte) {
-	ip.Dumpf(message, "broadcast (%v bytes)", len(message))
+	ip.DumpRequestf(message, "broadcast (%v bytes)", len(message))
 
 	listener := net.ListenConfig{
 		Control: func(network, address string, connection syscall.RawConn) error {
@@ -285,11 +300,15 @@ func (ip *ipOut) broadcast(id uint32, message []byte) {
 	} else {
 		defer socket.Close()
 
+		timeout := conn.Timeout(message, ip.settings, ip.timeout)
+		replied := atomic.Bool{}
+		learn := len(message) > 1 && message[1] == 0x94
+
 		if err := socket.SetWriteDeadline(time.Now().Add(1000 * time.Millisecond)); err != nil {
 			ip.Warnf("%v", err)
 		}
 
-		if err := socket.SetReadDeadline(time.Now().Add(5*time.Second + ip.timeout)); err != nil {
+		if err := socket.SetReadDeadline(time.Now().Add(5*time.Second + timeout)); err != nil {
 			ip.Warnf("%v", err)
 		}
 
@@ -298,7 +317,7 @@ func (ip *ipOut) broadcast(id uint32, message []byte) {
 		} else {
 			ip.Debugf("sent %v bytes to %v\n", N, ip.broadcastAddr)
 
-			ctx, cancel := context.WithTimeout(ip.ctx, ip.timeout+5*time.Second)
+			ctx, cancel := context.WithTimeout(ip.ctx, timeout+5*time.Second)
 
 			defer cancel()
 
@@ -312,7 +331,13 @@ func (ip *ipOut) broadcast(id uint32, message []byte) {
 					} else if err != nil {
 						return
 					} else {
-						ip.Dumpf(reply[0:N], "received %v bytes from %v", N, remote)
+						ip.DumpReplyf(reply[0:N], "received %v bytes from %v", N, remote)
+
+						if learn {
+							ip.learn(reply[:N], remote)
+						}
+
+						replied.Store(true)
 
 						ip.ch <- protocol.Message{
 							ID:      id,
@@ -322,17 +347,50 @@ func (ip *ipOut) broadcast(id uint32, message []byte) {
 				}
 			}()
 
-			select {
-			case <-time.After(ip.timeout):
-				// Ok
+			attempts := conn.Attempts(message, ip.retries, timeout)
+			for i, wait := range attempts {
+				select {
+				case <-time.After(wait):
+					// Ok
+
+				case <-ctx.Done():
+					ip.Warnf("%v", ctx.Err())
+					return
+				}
+
+				if i+1 < len(attempts) && !replied.Load() {
+					ip.Debugf("request %v  no reply - retrying (%v of %v)", id, i+1, len(attempts)-1)
 
-			case <-ctx.Done():
-				ip.Warnf("%v", ctx.Err())
+					if err := socket.SetWriteDeadline(time.Now().Add(1000 * time.Millisecond)); err != nil {
+						ip.Warnf("%v", err)
+					} else if _, err := socket.WriteTo(message, ip.broadcastAddr); err != nil {
+						ip.Warnf("%v", err)
+					}
+				}
 			}
 		}
 	}
 }
 
+// learn records the controller address from a reply to a broadcast get-device request.
+func (ip *ipOut) learn(reply []byte, remote net.Addr) {
+	if addr, ok := remote.(*net.UDPAddr); ok && len(reply) == 64 && reply[0] == 0x17 && reply[1] == 0x94 {
+		controller := binary.LittleEndian.Uint32(reply[4:])
+
+		if controller == 0 {
+			return
+		} else if _, ok := ip.controllers[controller]; ok {
+			return
+		}
+
+		if updated, err := ip.learned.learn(controller, addr.AddrPort()); err != nil {
+			ip.Warnf("%v", err)
+		} else if updated {
+			ip.Infof("learned controller %v address %v", controller, addr)
+		}
+	}
+}
+
 func resolve(addr string) (any, error) {
 	if strings.HasPrefix(addr, "tcp::") {
 		if v, err := netip.ParseAddrPort(addr[5:]); err != nil {
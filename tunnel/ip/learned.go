@@ -0,0 +1,121 @@
+package ip
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// learned holds the controller addresses learned from the replies to broadcast get-device requests,
+// optionally persisted to a JSON file so that they survive a restart. A learned address is forgotten
+// if the controller does not reply to a request sent to that address.
+type learned struct {
+	controllers map[uint32]learnedAddr
+	file        string
+	sync.RWMutex
+}
+
+type learnedAddr struct {
+	Address netip.AddrPort `json:"address"`
+	Seen    time.Time      `json:"seen"`
+}
+
+// newLearned creates the learned controller address table, loading the persisted addresses if the file
+// exists. The table is usable (but empty) even if the file could not be loaded.
+func newLearned(file string) (*learned, error) {
+	l := learned{
+		controllers: map[uint32]learnedAddr{},
+		file:        file,
+	}
+
+	if file != "" {
+		if bytes, err := os.ReadFile(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return &l, err
+		} else if err == nil {
+			m := map[string]learnedAddr{}
+			if err := json.Unmarshal(bytes, &m); err != nil {
+				return &l, err
+			}
+
+			for k, v := range m {
+				if controller, err := strconv.ParseUint(k, 10, 32); err == nil && controller != 0 && v.Address.IsValid() {
+					l.controllers[uint32(controller)] = v
+				}
+			}
+		}
+	}
+
+	return &l, nil
+}
+
+func (l *learned) get(controller uint32) (*net.UDPAddr, bool) {
+	l.RLock()
+	defer l.RUnlock()
+
+	if v, ok := l.controllers[controller]; ok {
+		return net.UDPAddrFromAddrPort(v.Address), true
+	}
+
+	return nil, false
+}
+
+// learn records the address of a controller and returns true if the address is new or has changed.
+func (l *learned) learn(controller uint32, addr netip.AddrPort) (bool, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	addr = netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+	v, ok := l.controllers[controller]
+	l.controllers[controller] = learnedAddr{
+		Address: addr,
+		Seen:    time.Now(),
+	}
+
+	if ok && v.Address == addr {
+		return false, nil
+	}
+
+	return true, l.save()
+}
+
+func (l *learned) forget(controller uint32) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if _, ok := l.controllers[controller]; ok {
+		delete(l.controllers, controller)
+
+		return l.save()
+	}
+
+	return nil
+}
+
+func (l *learned) save() error {
+	if l.file == "" {
+		return nil
+	}
+
+	m := map[string]learnedAddr{}
+	for k, v := range l.controllers {
+		m[strconv.FormatUint(uint64(k), 10)] = v
+	}
+
+	bytes, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(l.file), "."+filepath.Base(l.file)+".tmp")
+	if err := os.WriteFile(tmp, bytes, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, l.file)
+}
@@ -0,0 +1,186 @@
+package ip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// pool holds a persistent TCP connection for each controller. Requests to a controller are serialised
+// on the connection, connections are redialled after a failure and connections that have been idle for
+// longer than the idle timeout are closed.
+type pool struct {
+	connections map[string]*pooled
+	idle        time.Duration
+	sync.Mutex
+}
+
+type pooled struct {
+	addr *net.TCPAddr
+	conn net.Conn
+	used time.Time
+	sync.Mutex
+}
+
+const TCP_IDLE_TIMEOUT = 30 * time.Second
+const TCP_KEEPALIVE = 15 * time.Second
+
+var errStale = errors.New("stale connection")
+
+func newPool(idle time.Duration) *pool {
+	return &pool{
+		connections: map[string]*pooled{},
+		idle:        idle,
+	}
+}
+
+func (p *pool) get(addr *net.TCPAddr) *pooled {
+	p.Lock()
+	defer p.Unlock()
+
+	key := fmt.Sprintf("%v", addr)
+	if c, ok := p.connections[key]; ok {
+		return c
+	}
+
+	c := pooled{
+		addr: addr,
+	}
+
+	p.connections[key] = &c
+
+	return &c
+}
+
+// expire closes the connections that have been idle for longer than the idle timeout.
+func (p *pool) expire() {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, c := range p.connections {
+		if c.TryLock() {
+			if c.conn != nil && time.Since(c.used) > p.idle {
+				c.close()
+			}
+
+			c.Unlock()
+		}
+	}
+}
+
+func (p *pool) close() {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, c := range p.connections {
+		c.Lock()
+		c.close()
+		c.Unlock()
+	}
+}
+
+// exchange sends a request to the controller and waits for the reply, dialling a new connection if
+// there is no open connection. A request that fails on a reused connection because the controller has
+// closed it is retried once on a new connection. The connection is closed after any other error so that
+// a late reply is not returned for the next request.
+func (c *pooled) exchange(message []byte, deadline time.Time) ([]byte, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	reply, err := c.send(message, deadline)
+	if errors.Is(err, errStale) {
+		reply, err = c.send(message, deadline)
+	}
+
+	if err != nil {
+		c.close()
+	}
+
+	return reply, err
+}
+
+func (c *pooled) send(message []byte, deadline time.Time) ([]byte, error) {
+	reused := c.conn != nil
+
+	if c.conn == nil {
+		if connection, err := dial(c.addr, deadline); err != nil {
+			return nil, err
+		} else {
+			c.conn = connection
+		}
+	}
+
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if _, err := c.conn.Write(message); err != nil {
+		return nil, c.stale(reused, err)
+	}
+
+	reply := make([]byte, 64)
+	if _, err := io.ReadFull(c.conn, reply); err != nil {
+		return nil, c.stale(reused, err)
+	}
+
+	c.used = time.Now()
+
+	return reply, nil
+}
+
+// stale closes the connection and returns errStale if a reused connection was closed by the controller.
+func (c *pooled) stale(reused bool, err error) error {
+	if reused && (errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)) {
+		c.close()
+
+		return fmt.Errorf("%w (%v)", errStale, err)
+	}
+
+	return err
+}
+
+func (c *pooled) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func dial(addr *net.TCPAddr, deadline time.Time) (net.Conn, error) {
+	bind := &net.TCPAddr{
+		IP:   net.IPv4(0, 0, 0, 0),
+		Port: 0,
+		Zone: "",
+	}
+
+	dialer := net.Dialer{
+		Deadline:  deadline,
+		LocalAddr: bind,
+		KeepAlive: TCP_KEEPALIVE,
+		Control: func(network, address string, connection syscall.RawConn) (err error) {
+			var operr error
+
+			f := func(fd uintptr) {
+				operr = setSocketOptions(fd)
+			}
+
+			if err := connection.Control(f); err != nil {
+				return err
+			} else {
+				return operr
+			}
+		},
+	}
+
+	if connection, err := dialer.Dial("tcp4", fmt.Sprintf("%v", addr)); err != nil {
+		return nil, err
+	} else if connection == nil {
+		return nil, fmt.Errorf("invalid TCP socket (%v)", connection)
+	} else {
+		return connection, nil
+	}
+}
@@ -0,0 +1,162 @@
+package ip
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolReusesConnection(t *testing.T) {
+	addr, accepted := listen(t, func(n int32, c net.Conn) {
+		echo(c)
+	})
+
+	p := newPool(TCP_IDLE_TIMEOUT)
+	defer p.close()
+
+	for i := byte(1); i <= 2; i++ {
+		exchange(t, p.get(addr), i, 1*time.Second)
+	}
+
+	if n := accepted.Load(); n != 1 {
+		t.Errorf("incorrect number of connections - expected:%v, got:%v", 1, n)
+	}
+}
+
+func TestPoolRedialsClosedConnection(t *testing.T) {
+	addr, accepted := listen(t, func(n int32, c net.Conn) {
+		defer c.Close()
+
+		request := make([]byte, 64)
+		if _, err := io.ReadFull(c, request); err == nil {
+			c.Write(request)
+		}
+	})
+
+	p := newPool(TCP_IDLE_TIMEOUT)
+	defer p.close()
+
+	exchange(t, p.get(addr), 1, 1*time.Second)
+	time.Sleep(100 * time.Millisecond)
+	exchange(t, p.get(addr), 2, 1*time.Second)
+
+	if n := accepted.Load(); n != 2 {
+		t.Errorf("incorrect number of connections - expected:%v, got:%v", 2, n)
+	}
+}
+
+func TestPoolClosesConnectionAfterTimeout(t *testing.T) {
+	addr, accepted := listen(t, func(n int32, c net.Conn) {
+		if n == 1 {
+			request := make([]byte, 64)
+			if _, err := io.ReadFull(c, request); err == nil {
+				time.Sleep(250 * time.Millisecond)
+				c.Write(request)
+			}
+		}
+
+		echo(c)
+	})
+
+	p := newPool(TCP_IDLE_TIMEOUT)
+	defer p.close()
+
+	c := p.get(addr)
+	if _, err := c.exchange(message(1), time.Now().Add(50*time.Millisecond)); err == nil {
+		t.Fatalf("expected timeout")
+	}
+
+	if c.conn != nil {
+		t.Errorf("connection not closed after timeout")
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	exchange(t, c, 2, 1*time.Second)
+
+	if n := accepted.Load(); n != 2 {
+		t.Errorf("incorrect number of connections - expected:%v, got:%v", 2, n)
+	}
+}
+
+func TestPoolExpiresIdleConnections(t *testing.T) {
+	addr, _ := listen(t, func(n int32, c net.Conn) {
+		echo(c)
+	})
+
+	p := newPool(100 * time.Millisecond)
+	defer p.close()
+
+	c := p.get(addr)
+	exchange(t, c, 1, 1*time.Second)
+
+	p.expire()
+	if c.conn == nil {
+		t.Errorf("active connection expired")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	p.expire()
+	if c.conn != nil {
+		t.Errorf("idle connection not expired")
+	}
+}
+
+func listen(t *testing.T, handler func(int32, net.Conn)) (*net.TCPAddr, *atomic.Int32) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+
+	var accepted atomic.Int32
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go handler(accepted.Add(1), c)
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr), &accepted
+}
+
+func echo(c net.Conn) {
+	defer c.Close()
+
+	request := make([]byte, 64)
+	for {
+		if _, err := io.ReadFull(c, request); err != nil {
+			return
+		} else if _, err := c.Write(request); err != nil {
+			return
+		}
+	}
+}
+
+func exchange(t *testing.T, c *pooled, seq byte, timeout time.Duration) {
+	expected := message(seq)
+
+	if reply, err := c.exchange(message(seq), time.Now().Add(timeout)); err != nil {
+		t.Fatalf("request %v: unexpected error (%v)", seq, err)
+	} else if !reflect.DeepEqual(reply, expected) {
+		t.Errorf("request %v: incorrect reply\n   expected:%v\n   got:     %v", seq, expected, reply)
+	}
+}
+
+func message(seq byte) []byte {
+	m := make([]byte, 64)
+	m[0] = 0x17
+	m[1] = 0x94
+	m[8] = seq
+
+	return m
+}
@@ -0,0 +1,217 @@
+package nat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// nat wraps an OUT connector and translates the IPv4 addresses in controller requests and replies
+// between the addresses used by the remote applications and the addresses on the controller LAN:
+//
+//   - set-listener requests: the event listener address and port (remote → local)
+//   - set-address requests: the controller IP address and gateway (remote → local)
+//   - get-listener replies: the event listener address and port (local → remote)
+//   - get-device replies: the controller IP address and gateway (local → remote)
+type nat struct {
+	conn.Conn
+	out   tunnel.Conn
+	table *Table
+}
+
+// Table is the list of remote ↔ local address mappings. A mapping is either between two addresses (the
+// port is unchanged) or between two address:port pairs. Address:port mappings take precedence over
+// address mappings.
+type Table struct {
+	mappings []mapping
+}
+
+type mapping struct {
+	remote netip.AddrPort
+	local  netip.AddrPort
+}
+
+// NewTable creates an address translation table from a map of remote to local addresses e.g.
+//
+//	"10.0.0.5:60001" = "192.168.1.100:60001"
+//	"10.0.0.6"       = "192.168.1.100"
+func NewTable(m map[string]string) (*Table, error) {
+	t := Table{}
+
+	for k, v := range m {
+		remote, err := parse(k)
+		if err != nil {
+			return nil, err
+		}
+
+		local, err := parse(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if (remote.Port() == 0) != (local.Port() == 0) {
+			return nil, fmt.Errorf("invalid address mapping '%v = %v' (mixed address and address:port)", k, v)
+		}
+
+		t.mappings = append(t.mappings, mapping{remote: remote, local: local})
+	}
+
+	// ... address:port mappings first, then sorted for a deterministic match order
+	slices.SortFunc(t.mappings, func(p, q mapping) int {
+		if (p.remote.Port() == 0) != (q.remote.Port() == 0) {
+			if p.remote.Port() != 0 {
+				return -1
+			}
+
+			return 1
+		}
+
+		return p.remote.Compare(q.remote)
+	})
+
+	return &t, nil
+}
+
+// NewNAT wraps an OUT connector with the address translation table.
+func NewNAT(out tunnel.Conn, table *Table) *nat {
+	n := nat{
+		Conn: conn.Conn{
+			Tag: "NAT",
+		},
+		out:   out,
+		table: table,
+	}
+
+	for _, m := range table.mappings {
+		n.Infof("%v ↔ %v", format(m.remote), format(m.local))
+	}
+
+	return &n
+}
+
+func (n *nat) Close() {
+	n.out.Close()
+}
+
+func (n *nat) Run(router *router.Switch) error {
+	filtered := router.Filter(n.received)
+
+	return n.out.Run(&filtered)
+}
+
+func (n *nat) Send(id uint32, message []byte) {
+	if len(message) == 64 && message[0] == 0x17 {
+		switch message[1] {
+		case 0x90: // set-listener
+			message = n.rewrite(id, message, true, n.table.Local, 8)
+
+		case 0x96: // set-address
+			message = n.rewrite(id, message, false, n.table.Local, 8, 16)
+		}
+	}
+
+	n.out.Send(id, message)
+}
+
+func (n *nat) received(id uint32, message []byte) []byte {
+	if len(message) == 64 && message[0] == 0x17 {
+		switch message[1] {
+		case 0x92: // get-listener
+			return n.rewrite(id, message, true, n.table.Remote, 8)
+
+		case 0x94: // get-device
+			return n.rewrite(id, message, false, n.table.Remote, 8, 16)
+		}
+	}
+
+	return message
+}
+
+// rewrite translates the IPv4 addresses at the offsets in a request or reply (and optionally the port
+// following the address), returning a modified copy of the message if any address was translated.
+func (n *nat) rewrite(id uint32, message []byte, port bool, translate func(netip.AddrPort) (netip.AddrPort, bool), offsets ...int) []byte {
+	var rewritten []byte
+
+	for _, offset := range offsets {
+		addr := netip.AddrFrom4([4]byte(message[offset : offset+4]))
+		p := uint16(0)
+		if port {
+			p = binary.LittleEndian.Uint16(message[offset+4 : offset+6])
+		}
+
+		if to, ok := translate(netip.AddrPortFrom(addr, p)); ok {
+			if rewritten == nil {
+				rewritten = slices.Clone(message)
+			}
+
+			a := to.Addr().As4()
+
+			copy(rewritten[offset:offset+4], a[:])
+			if port {
+				binary.LittleEndian.PutUint16(rewritten[offset+4:offset+6], to.Port())
+			}
+
+			n.Debugf("%v  %v  %v → %v", id, protocol.FunctionName(message[1]), format(netip.AddrPortFrom(addr, p)), format(to))
+		}
+	}
+
+	if rewritten == nil {
+		return message
+	}
+
+	return rewritten
+}
+
+// Local returns the local address for a remote address.
+func (t *Table) Local(addr netip.AddrPort) (netip.AddrPort, bool) {
+	return t.translate(addr, func(m mapping) (netip.AddrPort, netip.AddrPort) { return m.remote, m.local })
+}
+
+// Remote returns the remote address for a local address.
+func (t *Table) Remote(addr netip.AddrPort) (netip.AddrPort, bool) {
+	return t.translate(addr, func(m mapping) (netip.AddrPort, netip.AddrPort) { return m.local, m.remote })
+}
+
+func (t *Table) translate(addr netip.AddrPort, f func(mapping) (netip.AddrPort, netip.AddrPort)) (netip.AddrPort, bool) {
+	for _, m := range t.mappings {
+		from, to := f(m)
+
+		switch {
+		case from.Port() != 0 && from == addr:
+			return to, true
+
+		case from.Port() == 0 && from.Addr() == addr.Addr():
+			return netip.AddrPortFrom(to.Addr(), addr.Port()), true
+		}
+	}
+
+	return addr, false
+}
+
+// parse parses an IPv4 address or address:port.
+func parse(s string) (netip.AddrPort, error) {
+	s = strings.TrimSpace(s)
+
+	if addr, err := netip.ParseAddr(s); err == nil && addr.Is4() {
+		return netip.AddrPortFrom(addr, 0), nil
+	} else if addr, err := netip.ParseAddrPort(s); err == nil && addr.Addr().Is4() && addr.Port() != 0 {
+		return addr, nil
+	}
+
+	return netip.AddrPort{}, fmt.Errorf("invalid IPv4 address '%v'", s)
+}
+
+func format(addr netip.AddrPort) string {
+	if addr.Port() == 0 {
+		return addr.Addr().String()
+	}
+
+	return addr.String()
+}
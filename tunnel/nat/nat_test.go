@@ -0,0 +1,158 @@
+package nat
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func message(function byte, addr string) []byte {
+	m := make([]byte, 64)
+	m[0] = 0x17
+	m[1] = function
+	binary.LittleEndian.PutUint32(m[4:8], 405419896)
+
+	if a, err := netip.ParseAddrPort(addr); err == nil {
+		b := a.Addr().As4()
+		copy(m[8:12], b[:])
+		binary.LittleEndian.PutUint16(m[12:14], a.Port())
+	} else {
+		b := netip.MustParseAddr(addr).As4()
+		copy(m[8:12], b[:])
+	}
+
+	return m
+}
+
+func table(t *testing.T) *Table {
+	table, err := NewTable(map[string]string{
+		"10.0.0.5:60001": "192.168.1.10:60001",
+		"10.0.0.5":       "192.168.1.11",
+		"10.0.0.100":     "192.168.1.100",
+		"10.0.0.1":       "192.168.1.1",
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	return table
+}
+
+func TestNewTableWithInvalidMapping(t *testing.T) {
+	tests := []map[string]string{
+		{"10.0.0.5": "192.168.1.10:60001"},
+		{"10.0.0.5:60001": "qwerty"},
+		{"::1": "192.168.1.10"},
+	}
+
+	for _, m := range tests {
+		if _, err := NewTable(m); err == nil {
+			t.Errorf("expected error for %v", m)
+		}
+	}
+}
+
+func TestTableLocal(t *testing.T) {
+	tests := []struct {
+		remote   string
+		expected string
+		ok       bool
+	}{
+		{"10.0.0.5:60001", "192.168.1.10:60001", true},
+		{"10.0.0.5:60002", "192.168.1.11:60002", true},
+		{"10.0.0.6:60001", "10.0.0.6:60001", false},
+	}
+
+	tt := table(t)
+
+	for _, v := range tests {
+		local, ok := tt.Local(netip.MustParseAddrPort(v.remote))
+		if ok != v.ok || local != netip.MustParseAddrPort(v.expected) {
+			t.Errorf("incorrect local address for %v - expected:%v %v, got:%v %v", v.remote, v.expected, v.ok, local, ok)
+		}
+	}
+}
+
+func TestSetListenerRequest(t *testing.T) {
+	n := NewNAT(nil, table(t))
+
+	request := message(0x90, "10.0.0.5:60001")
+	expected := message(0x90, "192.168.1.10:60001")
+	original := message(0x90, "10.0.0.5:60001")
+
+	if rewritten := n.rewrite(1, request, true, n.table.Local, 8); !reflect.DeepEqual(rewritten, expected) {
+		t.Errorf("incorrect set-listener request\n   expected:%v\n   got:     %v", expected, rewritten)
+	}
+
+	if !reflect.DeepEqual(request, original) {
+		t.Errorf("original request modified")
+	}
+}
+
+func TestGetListenerReply(t *testing.T) {
+	n := NewNAT(nil, table(t))
+
+	reply := message(0x92, "192.168.1.10:60001")
+	expected := message(0x92, "10.0.0.5:60001")
+
+	if rewritten := n.received(1, reply); !reflect.DeepEqual(rewritten, expected) {
+		t.Errorf("incorrect get-listener reply\n   expected:%v\n   got:     %v", expected, rewritten)
+	}
+}
+
+func TestGetDeviceReply(t *testing.T) {
+	n := NewNAT(nil, table(t))
+
+	reply := message(0x94, "192.168.1.100")
+	binary.LittleEndian.PutUint16(reply[12:14], 0xffff)
+
+	expected := message(0x94, "10.0.0.100")
+	binary.LittleEndian.PutUint16(expected[12:14], 0xffff)
+
+	if rewritten := n.received(1, reply); !reflect.DeepEqual(rewritten, expected) {
+		t.Errorf("incorrect get-device reply\n   expected:%v\n   got:     %v", expected, rewritten)
+	}
+}
+
+func TestSetAddressRequest(t *testing.T) {
+	n := NewNAT(nil, table(t))
+
+	request := message(0x96, "10.0.0.100")
+	copy(request[12:16], []byte{255, 255, 255, 0})
+	copy(request[16:20], []byte{10, 0, 0, 1})
+
+	expected := message(0x96, "192.168.1.100")
+	copy(expected[12:16], []byte{255, 255, 255, 0})
+	copy(expected[16:20], []byte{192, 168, 1, 1})
+
+	if rewritten := n.rewrite(1, request, false, n.table.Local, 8, 16); !reflect.DeepEqual(rewritten, expected) {
+		t.Errorf("incorrect set-address request\n   expected:%v\n   got:     %v", expected, rewritten)
+	}
+}
+
+func TestGetDeviceReplyGateway(t *testing.T) {
+	n := NewNAT(nil, table(t))
+
+	reply := message(0x94, "192.168.1.20")
+	copy(reply[16:20], []byte{192, 168, 1, 1})
+
+	expected := message(0x94, "192.168.1.20")
+	copy(expected[16:20], []byte{10, 0, 0, 1})
+
+	if rewritten := n.received(1, reply); !reflect.DeepEqual(rewritten, expected) {
+		t.Errorf("incorrect get-device reply\n   expected:%v\n   got:     %v", expected, rewritten)
+	}
+}
+
+func TestUntranslatedReply(t *testing.T) {
+	n := NewNAT(nil, table(t))
+
+	reply := message(0x92, "192.168.1.20:60001")
+	expected := message(0x92, "192.168.1.20:60001")
+
+	if rewritten := n.received(1, reply); !reflect.DeepEqual(rewritten, expected) {
+		t.Errorf("incorrect get-listener reply\n   expected:%v\n   got:     %v", expected, rewritten)
+	}
+}
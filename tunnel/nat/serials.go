@@ -0,0 +1,100 @@
+package nat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// serials wraps an OUT connector and translates controller serial numbers between the serial number of
+// the controller and the (virtual) serial number presented to the software on the other side of the
+// tunnel. Requests are translated from the virtual to the controller serial number and replies from the
+// controller to the virtual serial number. For an event tunnel the events are translated from the
+// controller to the virtual serial number.
+type serials struct {
+	conn.Conn
+	out      tunnel.Conn
+	virtual  map[uint32]uint32
+	physical map[uint32]uint32
+	events   bool
+}
+
+// NewSerials wraps an OUT connector with a controller serial number → virtual serial number mapping. The
+// mapping must be one-to-one and may not include the broadcast serial number (0).
+func NewSerials(out tunnel.Conn, m map[uint32]uint32, events bool) (*serials, error) {
+	s := serials{
+		Conn: conn.Conn{
+			Tag: "NAT",
+		},
+		out:      out,
+		virtual:  map[uint32]uint32{},
+		physical: map[uint32]uint32{},
+		events:   events,
+	}
+
+	for _, controller := range slices.Sorted(maps.Keys(m)) {
+		virtual := m[controller]
+
+		if controller == 0 || virtual == 0 {
+			return nil, fmt.Errorf("invalid serial number mapping %v → %v", controller, virtual)
+		} else if v, ok := s.physical[virtual]; ok {
+			return nil, fmt.Errorf("duplicate virtual serial number %v (%v and %v)", virtual, v, controller)
+		}
+
+		s.virtual[controller] = virtual
+		s.physical[virtual] = controller
+
+		s.Infof("controller %v ↔ %v", controller, virtual)
+	}
+
+	return &s, nil
+}
+
+func (s *serials) Close() {
+	s.out.Close()
+}
+
+func (s *serials) Run(router *router.Switch) error {
+	filtered := router.Filter(s.received)
+
+	return s.out.Run(&filtered)
+}
+
+func (s *serials) Send(id uint32, message []byte) {
+	if s.events {
+		s.out.Send(id, s.translate(id, message, s.virtual))
+	} else {
+		s.out.Send(id, s.translate(id, message, s.physical))
+	}
+}
+
+func (s *serials) received(id uint32, message []byte) []byte {
+	return s.translate(id, message, s.virtual)
+}
+
+// translate returns a copy of the message with the serial number replaced if the serial number is in
+// the mapping, or the unmodified message otherwise. Events may also have the 0x19 start of message byte
+// used by V6.62 firmware.
+func (s *serials) translate(id uint32, message []byte, m map[uint32]uint32) []byte {
+	if len(message) != 64 || (message[0] != 0x17 && (!s.events || message[0] != 0x19)) {
+		return message
+	}
+
+	serial := binary.LittleEndian.Uint32(message[4:8])
+	if to, ok := m[serial]; ok {
+		translated := slices.Clone(message)
+		binary.LittleEndian.PutUint32(translated[4:8], to)
+
+		s.Debugf("%v  %v  %v → %v", id, protocol.FunctionName(message[1]), serial, to)
+
+		return translated
+	}
+
+	return message
+}
@@ -0,0 +1,104 @@
+package nat
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func serial(message []byte) uint32 {
+	return binary.LittleEndian.Uint32(message[4:8])
+}
+
+func withSerial(function byte, serial uint32) []byte {
+	m := make([]byte, 64)
+	m[0] = 0x17
+	m[1] = function
+	binary.LittleEndian.PutUint32(m[4:8], serial)
+
+	return m
+}
+
+func TestNewSerialsWithInvalidMapping(t *testing.T) {
+	tests := []map[uint32]uint32{
+		{0: 1405419896},
+		{405419896: 0},
+		{405419896: 1405419896, 303986753: 1405419896},
+	}
+
+	for _, m := range tests {
+		if _, err := NewSerials(nil, m, false); err == nil {
+			t.Errorf("expected error for %v", m)
+		}
+	}
+}
+
+func TestSerialsTranslate(t *testing.T) {
+	s, err := NewSerials(nil, map[uint32]uint32{405419896: 1405419896}, false)
+	if err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	tests := []struct {
+		serial   uint32
+		mapping  map[uint32]uint32
+		expected uint32
+	}{
+		{1405419896, s.physical, 405419896},
+		{405419896, s.virtual, 1405419896},
+		{303986753, s.physical, 303986753},
+		{0, s.physical, 0},
+	}
+
+	for _, v := range tests {
+		message := withSerial(0x20, v.serial)
+
+		if translated := s.translate(1, message, v.mapping); serial(translated) != v.expected {
+			t.Errorf("incorrect serial number for %v - expected:%v, got:%v", v.serial, v.expected, serial(translated))
+		}
+
+		if serial(message) != v.serial {
+			t.Errorf("original message modified")
+		}
+	}
+}
+
+func TestSerialsReceived(t *testing.T) {
+	s, err := NewSerials(nil, map[uint32]uint32{405419896: 1405419896}, false)
+	if err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	if reply := s.received(1, withSerial(0x94, 405419896)); serial(reply) != 1405419896 {
+		t.Errorf("incorrect reply serial number - expected:%v, got:%v", 1405419896, serial(reply))
+	}
+
+	if reply := s.received(1, []byte{0x17, 0x94, 0x00, 0x00}); len(reply) != 4 {
+		t.Errorf("invalid reply modified")
+	}
+}
+
+func TestSerialsTranslateV662Events(t *testing.T) {
+	tests := []struct {
+		events   bool
+		expected uint32
+	}{
+		{true, 1405419896},
+		{false, 405419896},
+	}
+
+	for _, v := range tests {
+		s, err := NewSerials(nil, map[uint32]uint32{405419896: 1405419896}, v.events)
+		if err != nil {
+			t.Fatalf("unexpected error (%v)", err)
+		}
+
+		message := withSerial(0x20, 405419896)
+		message[0] = 0x19
+
+		if translated := s.translate(1, message, s.virtual); serial(translated) != v.expected {
+			t.Errorf("events:%v - incorrect serial number - expected:%v, got:%v", v.events, v.expected, serial(translated))
+		} else if translated[0] != 0x19 {
+			t.Errorf("events:%v - incorrect start of message - expected:%02x, got:%02x", v.events, 0x19, translated[0])
+		}
+	}
+}
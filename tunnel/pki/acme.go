@@ -0,0 +1,123 @@
+package pki
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACME obtains and renews a server certificate automatically from an ACME certificate authority
+// (e.g. Let's Encrypt) using the TLS-ALPN-01 challenge and, optionally, the HTTP-01 challenge.
+type ACME struct {
+	manager   *autocert.Manager
+	challenge string
+}
+
+// NewACME creates an ACME certificate manager for the listed host names. Certificates and the
+// ACME account key are cached under <workdir>/acme. The directory URL defaults to Let's Encrypt
+// and the (optional) directory CA is used to verify a private ACME server (e.g. Pebble). The HTTP-01
+// challenge is only enabled if a challenge listener address is provided.
+func NewACME(hosts, directory, email, challenge, directoryCA, workdir string) (*ACME, error) {
+	domains := split(hosts)
+	if len(domains) == 0 {
+		return nil, nil
+	}
+
+	client := acme.Client{
+		DirectoryURL: directory,
+	}
+
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = autocert.DefaultACMEDirectory
+	}
+
+	if directoryCA != "" {
+		if bytes, err := os.ReadFile(directoryCA); err != nil {
+			return nil, err
+		} else {
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(bytes) {
+				return nil, fmt.Errorf("unable to parse ACME directory CA certificate %v", directoryCA)
+			}
+
+			client.HTTPClient = &http.Client{
+				Timeout: 30 * time.Second,
+				Transport: &http.Transport{
+					Proxy: http.ProxyFromEnvironment,
+					TLSClientConfig: &tls.Config{
+						RootCAs:    roots,
+						MinVersion: tls.VersionTLS12,
+					},
+				},
+			}
+		}
+	}
+
+	cache := filepath.Join(workdir, "acme")
+	if err := os.MkdirAll(cache, 0700); err != nil {
+		return nil, err
+	}
+
+	manager := autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cache),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      email,
+		Client:     &client,
+	}
+
+	infof("ACME certificates for %v from %v (cache %v)", domains, client.DirectoryURL, cache)
+
+	return &ACME{
+		manager:   &manager,
+		challenge: challenge,
+	}, nil
+}
+
+// Apply configures a TLS server to use the ACME certificates and to answer TLS-ALPN-01 challenges.
+func (a *ACME) Apply(config *tls.Config) {
+	if a != nil {
+		config.Certificates = nil
+		config.GetCertificate = a.manager.GetCertificate
+		config.NextProtos = append(config.NextProtos, acme.ALPNProto)
+	}
+}
+
+// Listen runs the HTTP-01 challenge listener (if configured) until the context is cancelled. Requests
+// other than ACME challenges are redirected to HTTPS.
+func (a *ACME) Listen(ctx context.Context) {
+	if a == nil || a.challenge == "" {
+		return
+	}
+
+	srv := http.Server{
+		Addr:              a.challenge,
+		Handler:           a.manager.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		infof("ACME HTTP-01 challenge listener on %v", a.challenge)
+
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			warnf("ACME HTTP-01 challenge listener (%v)", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		srv.Shutdown(shutdown)
+	}()
+}
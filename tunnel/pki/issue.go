@@ -0,0 +1,327 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Subject holds the subject name and subject alternative names for a new certificate.
+type Subject struct {
+	CommonName     string
+	Organization   string
+	DNSNames       []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	EmailAddresses []string
+}
+
+// NewSubject creates a Subject from a common name and a comma or space separated list of subject
+// alternative names. Each SAN is classified as an IP address, URI (e.g. a SPIFFE ID), email
+// address or DNS name.
+func NewSubject(name, organization, sans string) (*Subject, error) {
+	subject := Subject{
+		CommonName:   strings.TrimSpace(name),
+		Organization: strings.TrimSpace(organization),
+	}
+
+	for _, san := range split(sans) {
+		if ip := net.ParseIP(san); ip != nil {
+			subject.IPAddresses = append(subject.IPAddresses, ip)
+		} else if strings.Contains(san, "://") {
+			if uri, err := url.Parse(san); err != nil {
+				return nil, fmt.Errorf("invalid SAN URI '%v' (%v)", san, err)
+			} else {
+				subject.URIs = append(subject.URIs, uri)
+			}
+		} else if strings.Contains(san, "@") {
+			subject.EmailAddresses = append(subject.EmailAddresses, san)
+		} else {
+			subject.DNSNames = append(subject.DNSNames, san)
+		}
+	}
+
+	if subject.CommonName == "" {
+		return nil, fmt.Errorf("missing certificate common name")
+	}
+
+	return &subject, nil
+}
+
+// NewCA creates a self-signed CA certificate and ECDSA P-256 key.
+func NewCA(subject Subject, validity time.Duration) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := subject.template(validity)
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	template.BasicConstraintsValid = true
+	template.IsCA = true
+	template.MaxPathLenZero = true
+
+	if template.SerialNumber, err = serialNumber(); err != nil {
+		return nil, nil, err
+	}
+
+	certificate, err := sign(template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certificate, key, nil
+}
+
+// IssueServer creates a server certificate and ECDSA P-256 key signed by the CA. The common name
+// is included in the DNS SANs if not already present because Go TLS clients only verify SANs.
+func IssueServer(subject Subject, validity time.Duration, ca *x509.Certificate, cakey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	if net.ParseIP(subject.CommonName) == nil && !contains(subject.DNSNames, subject.CommonName) {
+		subject.DNSNames = append([]string{subject.CommonName}, subject.DNSNames...)
+	}
+
+	return issue(subject, validity, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, ca, cakey)
+}
+
+// IssueClient creates a client certificate and ECDSA P-256 key signed by the CA.
+func IssueClient(subject Subject, validity time.Duration, ca *x509.Certificate, cakey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	return issue(subject, validity, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, ca, cakey)
+}
+
+// Renew reissues a certificate with the same subject, SANs, usage and key but a new serial number
+// and validity period. A CA certificate is renewed as a self-signed certificate (the CA and CA key
+// are ignored). The validity of any other certificate is limited to the validity of the CA.
+func Renew(certificate *x509.Certificate, key crypto.Signer, validity time.Duration, ca *x509.Certificate, cakey crypto.Signer) (*x509.Certificate, error) {
+	now := time.Now()
+	template := *certificate
+	template.NotBefore = now.Add(-5 * time.Minute)
+	template.NotAfter = now.Add(validity)
+
+	if serial, err := serialNumber(); err != nil {
+		return nil, err
+	} else {
+		template.SerialNumber = serial
+	}
+
+	if certificate.IsCA {
+		return sign(&template, &template, key.Public(), key)
+	}
+
+	if ca == nil || cakey == nil {
+		return nil, fmt.Errorf("renewing %v requires the issuing CA certificate and key", certificate.Subject)
+	} else if !ca.IsCA {
+		return nil, fmt.Errorf("%v is not a CA certificate", ca.Subject)
+	}
+
+	if template.NotAfter.After(ca.NotAfter) {
+		template.NotAfter = ca.NotAfter
+	}
+
+	return sign(&template, ca, key.Public(), cakey)
+}
+
+// Pin returns the SHA-256 hash of the certificate public key (SPKI) in the sha256/<base64> form
+// used by the --tls-pin option.
+func Pin(certificate *x509.Certificate) string {
+	hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+
+	return "sha256/" + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// LoadKey loads a PKCS#8, EC or PKCS#1 private key from a PEM file.
+func LoadKey(file string) (crypto.Signer, error) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		block, remaining := pem.Decode(bytes)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+				return nil, err
+			} else if signer, ok := key.(crypto.Signer); !ok {
+				return nil, fmt.Errorf("unsupported private key in %v", file)
+			} else {
+				return signer, nil
+			}
+
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		}
+
+		bytes = remaining
+	}
+
+	return nil, fmt.Errorf("no private key in %v", file)
+}
+
+// WriteKeypair saves a certificate and private key as PEM files. Existing files are only replaced if
+// overwrite is set and the key file is removed if the certificate cannot be written, so that a failure
+// does not leave an orphaned key that blocks the next attempt.
+func WriteKeypair(certfile string, certificate *x509.Certificate, keyfile string, key crypto.Signer, overwrite bool) error {
+	if !overwrite {
+		for _, file := range []string{keyfile, certfile} {
+			if _, err := os.Stat(file); err == nil {
+				return fmt.Errorf("%v already exists (use --overwrite to replace it)", file)
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	if err := WriteKey(keyfile, key, overwrite); err != nil {
+		return err
+	}
+
+	if err := WriteCertificate(certfile, certificate, overwrite); err != nil {
+		os.Remove(keyfile)
+		return err
+	}
+
+	return nil
+}
+
+// WriteCertificate saves a certificate as a PEM file. Existing files are only replaced if overwrite is set.
+func WriteCertificate(file string, certificate *x509.Certificate, overwrite bool) error {
+	block := pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: certificate.Raw,
+	}
+
+	return write(file, pem.EncodeToMemory(&block), 0644, overwrite)
+}
+
+// WriteKey saves a private key as a PKCS#8 PEM file readable only by the owner. Existing files are
+// only replaced if overwrite is set.
+func WriteKey(file string, key crypto.Signer, overwrite bool) error {
+	bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	block := pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: bytes,
+	}
+
+	return write(file, pem.EncodeToMemory(&block), 0600, overwrite)
+}
+
+func issue(subject Subject, validity time.Duration, usage []x509.ExtKeyUsage, ca *x509.Certificate, cakey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	if ca == nil || cakey == nil {
+		return nil, nil, fmt.Errorf("missing CA certificate or key")
+	} else if !ca.IsCA {
+		return nil, nil, fmt.Errorf("%v is not a CA certificate", ca.Subject)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := subject.template(validity)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = usage
+
+	if template.SerialNumber, err = serialNumber(); err != nil {
+		return nil, nil, err
+	}
+
+	if template.NotAfter.After(ca.NotAfter) {
+		template.NotAfter = ca.NotAfter
+	}
+
+	certificate, err := sign(template, ca, key.Public(), cakey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certificate, key, nil
+}
+
+func (s Subject) template(validity time.Duration) *x509.Certificate {
+	now := time.Now()
+	name := pkix.Name{
+		CommonName: s.CommonName,
+	}
+
+	if s.Organization != "" {
+		name.Organization = []string{s.Organization}
+	}
+
+	return &x509.Certificate{
+		Subject:        name,
+		NotBefore:      now.Add(-5 * time.Minute),
+		NotAfter:       now.Add(validity),
+		DNSNames:       s.DNSNames,
+		IPAddresses:    s.IPAddresses,
+		URIs:           s.URIs,
+		EmailAddresses: s.EmailAddresses,
+	}
+}
+
+func sign(template, parent *x509.Certificate, public crypto.PublicKey, key crypto.Signer) (*x509.Certificate, error) {
+	if bytes, err := x509.CreateCertificate(rand.Reader, template, parent, public, key); err != nil {
+		return nil, err
+	} else {
+		return x509.ParseCertificate(bytes)
+	}
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func write(file string, bytes []byte, mode os.FileMode, overwrite bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+
+	f, err := os.OpenFile(file, flags, mode)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%v already exists (use --overwrite to replace it)", file)
+		}
+		return err
+	}
+
+	if _, err := f.Write(bytes); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+package pki
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIssueAndRenew(t *testing.T) {
+	subject, err := NewSubject("tunnel.example.com", "", "127.0.0.1, tunnel.local, spiffe://uhppoted/tunnel")
+	if err != nil {
+		t.Fatalf("error creating subject (%v)", err)
+	}
+
+	ca, cakey, err := NewCA(Subject{CommonName: "test CA"}, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("error creating CA (%v)", err)
+	}
+
+	certificate, key, err := IssueServer(*subject, 48*time.Hour, ca, cakey)
+	if err != nil {
+		t.Fatalf("error issuing server certificate (%v)", err)
+	}
+
+	if certificate.NotAfter.After(ca.NotAfter) {
+		t.Errorf("server certificate expires after CA (%v)", certificate.NotAfter)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	for _, host := range []string{"tunnel.example.com", "tunnel.local", "127.0.0.1"} {
+		if _, err := certificate.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("server certificate not valid for %v (%v)", host, err)
+		}
+	}
+
+	renewed, err := Renew(certificate, key, 12*time.Hour, ca, cakey)
+	if err != nil {
+		t.Fatalf("error renewing server certificate (%v)", err)
+	}
+
+	if renewed.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+		t.Errorf("renewed certificate has the same serial number")
+	}
+
+	if Pin(renewed) != Pin(certificate) {
+		t.Errorf("renewed certificate public key changed")
+	}
+
+	if _, err := renewed.Verify(x509.VerifyOptions{DNSName: "tunnel.local", Roots: roots}); err != nil {
+		t.Errorf("renewed certificate not valid (%v)", err)
+	}
+
+	if renewed, err := Renew(certificate, key, 48*time.Hour, ca, cakey); err != nil {
+		t.Fatalf("error renewing server certificate (%v)", err)
+	} else if renewed.NotAfter.After(ca.NotAfter) {
+		t.Errorf("renewed certificate expires after CA (%v)", renewed.NotAfter)
+	}
+
+	if _, err := Renew(certificate, key, 12*time.Hour, certificate, key); err == nil {
+		t.Errorf("expected error renewing with a non-CA issuer")
+	}
+}
+
+func TestWriteKeypair(t *testing.T) {
+	dir := t.TempDir()
+	certfile := filepath.Join(dir, "ca.cert")
+	keyfile := filepath.Join(dir, "ca.key")
+
+	ca, key, err := NewCA(Subject{CommonName: "test CA"}, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("error creating CA (%v)", err)
+	}
+
+	if err := os.WriteFile(certfile, []byte("existing"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := WriteKeypair(certfile, ca, keyfile, key, false); err == nil {
+		t.Errorf("expected error for existing certificate file")
+	} else if _, err := os.Stat(keyfile); !os.IsNotExist(err) {
+		t.Errorf("key file written for existing certificate file")
+	}
+
+	if err := WriteKeypair(filepath.Join(dir, "missing", "ca.cert"), ca, keyfile, key, false); err == nil {
+		t.Errorf("expected error writing certificate")
+	} else if _, err := os.Stat(keyfile); !os.IsNotExist(err) {
+		t.Errorf("orphaned key file not removed")
+	}
+
+	if err := WriteKeypair(certfile, ca, keyfile, key, true); err != nil {
+		t.Errorf("unexpected error (%v)", err)
+	}
+}
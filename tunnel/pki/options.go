@@ -0,0 +1,182 @@
+package pki
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Options holds the TLS parameters shared by all the TLS based connectors.
+type Options struct {
+	MinVersion   uint16
+	MaxVersion   uint16
+	CipherSuites []uint16
+	Curves       []tls.CurveID
+	ALPN         []string
+	ServerName   string
+	Pins         [][]byte
+}
+
+var DefaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+}
+
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var curves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// NewOptions parses the TLS options from the command line/TOML configuration. List options are
+// comma or space separated (TOML arrays are accepted as is).
+func NewOptions(minVersion, maxVersion, ciphers, curveIDs, alpn, serverName, pins string) (*Options, error) {
+	options := Options{
+		MinVersion:   tls.VersionTLS12,
+		CipherSuites: DefaultCipherSuites,
+		ServerName:   strings.TrimSpace(serverName),
+	}
+
+	if v := strings.TrimSpace(minVersion); v != "" {
+		if version, ok := versions[v]; !ok {
+			return nil, fmt.Errorf("invalid TLS minimum version '%v'", v)
+		} else {
+			options.MinVersion = version
+		}
+	}
+
+	if v := strings.TrimSpace(maxVersion); v != "" {
+		if version, ok := versions[v]; !ok {
+			return nil, fmt.Errorf("invalid TLS maximum version '%v'", v)
+		} else {
+			options.MaxVersion = version
+		}
+	}
+
+	if options.MaxVersion != 0 && options.MaxVersion < options.MinVersion {
+		return nil, fmt.Errorf("TLS maximum version %v is less than minimum version %v", maxVersion, minVersion)
+	}
+
+	if list := split(ciphers); len(list) > 0 {
+		options.CipherSuites = []uint16{}
+
+	loop:
+		for _, name := range list {
+			for _, suite := range tls.CipherSuites() {
+				if strings.EqualFold(suite.Name, name) {
+					options.CipherSuites = append(options.CipherSuites, suite.ID)
+					continue loop
+				}
+			}
+
+			return nil, fmt.Errorf("invalid or insecure TLS cipher suite '%v'", name)
+		}
+	}
+
+	for _, name := range split(curveIDs) {
+		if curve, ok := curves[strings.ToUpper(name)]; !ok {
+			return nil, fmt.Errorf("invalid TLS curve '%v'", name)
+		} else {
+			options.Curves = append(options.Curves, curve)
+		}
+	}
+
+	options.ALPN = split(alpn)
+
+	for _, pin := range split(pins) {
+		if hash, err := parsePin(pin); err != nil {
+			return nil, err
+		} else {
+			options.Pins = append(options.Pins, hash)
+		}
+	}
+
+	return &options, nil
+}
+
+// Apply sets the TLS parameters on a tls.Config, using the default parameters if the options are nil.
+func (o *Options) Apply(config *tls.Config) {
+	if o == nil {
+		config.CipherSuites = DefaultCipherSuites
+		config.MinVersion = tls.VersionTLS12
+		return
+	}
+
+	config.MinVersion = o.MinVersion
+	config.MaxVersion = o.MaxVersion
+	config.CipherSuites = o.CipherSuites
+	config.CurvePreferences = o.Curves
+	config.NextProtos = o.ALPN
+
+	if o.ServerName != "" {
+		config.ServerName = o.ServerName
+	}
+
+	if len(o.Pins) > 0 {
+		config.VerifyPeerCertificate = o.verifyPins
+	}
+}
+
+// verifyPins rejects a peer unless the SHA-256 hash of the public key (SPKI) of a certificate in the
+// verified chain matches one of the pinned hashes.
+func (o *Options) verifyPins(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+	for _, chain := range chains {
+		for _, certificate := range chain {
+			hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+			for _, pin := range o.Pins {
+				if string(pin) == string(hash[:]) {
+					return nil
+				}
+			}
+		}
+	}
+
+	if len(chains) == 0 && len(rawCerts) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("peer certificate does not match any pinned public key")
+	warnf("%v", err)
+
+	return err
+}
+
+func parsePin(pin string) ([]byte, error) {
+	if strings.HasPrefix(pin, "sha256/") {
+		if hash, err := base64.StdEncoding.DecodeString(pin[7:]); err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate pin '%v'", pin)
+		} else {
+			return hash, nil
+		}
+	}
+
+	if hash, err := hex.DecodeString(strings.ReplaceAll(pin, ":", "")); err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("invalid certificate pin '%v'", pin)
+	} else {
+		return hash, nil
+	}
+}
+
+func split(s string) []string {
+	list := []string{}
+	for _, v := range regexp.MustCompile(`[\s,]+`).Split(strings.Trim(strings.TrimSpace(s), "[]"), -1) {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,54 @@
+package pki
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+func TestNewOptions(t *testing.T) {
+	options, err := NewOptions("1.3", "", "[TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384]", "X25519,P256", "uhppoted", "tunnel.example.com", "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+	if err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	if options.MinVersion != tls.VersionTLS13 {
+		t.Errorf("incorrect minimum version - expected:%v, got:%v", tls.VersionTLS13, options.MinVersion)
+	}
+
+	if expected := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}; !reflect.DeepEqual(options.CipherSuites, expected) {
+		t.Errorf("incorrect cipher suites - expected:%v, got:%v", expected, options.CipherSuites)
+	}
+
+	if expected := []tls.CurveID{tls.X25519, tls.CurveP256}; !reflect.DeepEqual(options.Curves, expected) {
+		t.Errorf("incorrect curves - expected:%v, got:%v", expected, options.Curves)
+	}
+
+	if expected := []string{"uhppoted"}; !reflect.DeepEqual(options.ALPN, expected) {
+		t.Errorf("incorrect ALPN - expected:%v, got:%v", expected, options.ALPN)
+	}
+
+	if len(options.Pins) != 1 || len(options.Pins[0]) != 32 {
+		t.Errorf("incorrect pins - got:%v", options.Pins)
+	}
+}
+
+func TestNewOptionsWithInvalidVersion(t *testing.T) {
+	if _, err := NewOptions("1.3", "1.2", "", "", "", "", ""); err == nil {
+		t.Errorf("expected error for maximum version less than minimum version")
+	}
+
+	if _, err := NewOptions("1.4", "", "", "", "", "", ""); err == nil {
+		t.Errorf("expected error for invalid minimum version")
+	}
+
+	for _, v := range []string{"1.0", "1.1"} {
+		if _, err := NewOptions(v, "", "", "", "", "", ""); err == nil {
+			t.Errorf("expected error for deprecated minimum version %v", v)
+		}
+
+		if _, err := NewOptions("", v, "", "", "", "", ""); err == nil {
+			t.Errorf("expected error for deprecated maximum version %v", v)
+		}
+	}
+}
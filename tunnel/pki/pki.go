@@ -0,0 +1,56 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/uhppoted/uhppoted-tunnel/log"
+)
+
+// Certificates loads the certificates in a PEM file.
+func Certificates(file string) ([]*x509.Certificate, error) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	certificates := []*x509.Certificate{}
+	for {
+		block, remaining := pem.Decode(bytes)
+		if block == nil {
+			break
+		}
+
+		if block.Type == "CERTIFICATE" {
+			if certificate, err := x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, err
+			} else {
+				certificates = append(certificates, certificate)
+			}
+		}
+
+		bytes = remaining
+	}
+
+	return certificates, nil
+}
+
+func debugf(format string, args ...any) {
+	f := fmt.Sprintf("%-10v %v", "PKI", format)
+
+	log.Debugf(f, args...)
+}
+
+func infof(format string, args ...any) {
+	f := fmt.Sprintf("%-10v %v", "PKI", format)
+
+	log.Infof(f, args...)
+}
+
+func warnf(format string, args ...any) {
+	f := fmt.Sprintf("%-10v %v", "PKI", format)
+
+	log.Warnf(f, args...)
+}
@@ -0,0 +1,499 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Revocation implements certificate revocation checking for TLS peers using a (reloadable) CRL
+// file and/or OCSP.
+type Revocation struct {
+	crl       string
+	ocsp      bool
+	issuers   []*x509.Certificate
+	list      *x509.RevocationList
+	revoked   map[string]int
+	modified  time.Time
+	expired   bool
+	responses map[string]*cached
+	staples   map[string]*cached
+	client    http.Client
+	sync.RWMutex
+}
+
+// cached holds the last good OCSP response for a certificate along with the time after which it is
+// no longer usable and the time before which a failed query is not retried.
+type cached struct {
+	raw        []byte
+	response   *ocsp.Response
+	expires    time.Time
+	retry      time.Time
+	refreshing bool
+}
+
+const OCSP_TIMEOUT = 5 * time.Second
+const OCSP_REFRESH = 1 * time.Hour
+const OCSP_BACKOFF = 5 * time.Minute
+const OCSP_LIFETIME = 4 * time.Hour
+
+var reasons = map[int]string{
+	ocsp.Unspecified:          "unspecified",
+	ocsp.KeyCompromise:        "key compromise",
+	ocsp.CACompromise:         "CA compromise",
+	ocsp.AffiliationChanged:   "affiliation changed",
+	ocsp.Superseded:           "superseded",
+	ocsp.CessationOfOperation: "cessation of operation",
+	ocsp.CertificateHold:      "certificate hold",
+	ocsp.RemoveFromCRL:        "remove from CRL",
+	ocsp.PrivilegeWithdrawn:   "privilege withdrawn",
+	ocsp.AACompromise:         "AA compromise",
+}
+
+// NewRevocation returns a revocation checker for the CRL file and OCSP settings. Returns nil if
+// neither a CRL file nor OCSP is configured. The issuers are used to verify the CRL signature and
+// to request OCSP staples for a server certificate that does not include its issuer.
+func NewRevocation(crl string, enableOCSP bool, issuers []*x509.Certificate) (*Revocation, error) {
+	if crl == "" && !enableOCSP {
+		return nil, nil
+	}
+
+	r := Revocation{
+		crl:       crl,
+		ocsp:      enableOCSP,
+		issuers:   issuers,
+		revoked:   map[string]int{},
+		responses: map[string]*cached{},
+		staples:   map[string]*cached{},
+		client: http.Client{
+			Timeout: OCSP_TIMEOUT,
+		},
+	}
+
+	if crl != "" {
+		if err := r.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &r, nil
+}
+
+// VerifyConnection is intended for use as the tls.Config VerifyConnection callback and rejects
+// a connection if any certificate in the verified peer chain has been revoked.
+func (r *Revocation) VerifyConnection(cs tls.ConnectionState) error {
+	if r == nil || len(cs.VerifiedChains) == 0 {
+		return nil
+	}
+
+	chain := cs.VerifiedChains[0]
+
+	if r.crl != "" {
+		r.reload()
+		r.stale()
+
+		for _, certificate := range chain {
+			if err := r.checkCRL(certificate); err != nil {
+				warnf("%v", err)
+				return err
+			}
+		}
+	}
+
+	if r.ocsp && len(chain) > 1 {
+		if err := r.checkOCSP(chain[0], chain[1], cs.OCSPResponse); err != nil {
+			warnf("%v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetCertificate returns a tls.Config GetCertificate callback that staples the current OCSP
+// response for the server certificate. The staple is refreshed in the background before it expires
+// and the last good response is stapled in the meantime.
+func (r *Revocation) GetCertificate(keypair tls.Certificate) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var leaf, issuer *x509.Certificate
+
+	if r != nil && r.ocsp && len(keypair.Certificate) > 0 {
+		if c, err := x509.ParseCertificate(keypair.Certificate[0]); err != nil {
+			warnf("%v", err)
+		} else if issuer = r.issuer(c, keypair); issuer == nil {
+			debugf("no issuer certificate for %v - not stapling OCSP response", c.Subject)
+		} else if len(c.OCSPServer) == 0 {
+			debugf("no OCSP responder for %v - not stapling OCSP response", c.Subject)
+		} else {
+			leaf = c
+			r.staple(leaf, issuer)
+		}
+	}
+
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		certificate := keypair
+
+		if leaf != nil {
+			if response := r.staple(leaf, issuer); response != nil {
+				certificate.OCSPStaple = response
+			}
+		}
+
+		return &certificate, nil
+	}
+}
+
+// Staple wraps a tls.Config GetCertificate callback that returns a dynamically issued certificate (e.g.
+// an ACME certificate) to staple the current OCSP response for the returned certificate.
+func (r *Revocation) Staple(get func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if r == nil || !r.ocsp || get == nil {
+		return get
+	}
+
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		certificate, err := get(hello)
+		if err != nil || certificate == nil || len(certificate.Certificate) == 0 {
+			return certificate, err
+		}
+
+		leaf := certificate.Leaf
+		if leaf == nil {
+			if leaf, err = x509.ParseCertificate(certificate.Certificate[0]); err != nil {
+				warnf("%v", err)
+				return certificate, nil
+			}
+		}
+
+		if len(leaf.OCSPServer) == 0 {
+			return certificate, nil
+		} else if issuer := r.issuer(leaf, *certificate); issuer == nil {
+			return certificate, nil
+		} else if response := r.staple(leaf, issuer); response == nil {
+			return certificate, nil
+		} else {
+			stapled := *certificate
+			stapled.OCSPStaple = response
+
+			return &stapled, nil
+		}
+	}
+}
+
+func (r *Revocation) load() error {
+	info, err := os.Stat(r.crl)
+	if err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(r.crl)
+	if err != nil {
+		return err
+	}
+
+	if block, _ := pem.Decode(b); block != nil && block.Type == "X509 CRL" {
+		b = block.Bytes
+	}
+
+	list, err := x509.ParseRevocationList(b)
+	if err != nil {
+		return fmt.Errorf("invalid CRL %v (%v)", r.crl, err)
+	}
+
+	if len(r.issuers) > 0 {
+		verified := false
+		for _, issuer := range r.issuers {
+			if list.CheckSignatureFrom(issuer) == nil {
+				verified = true
+				break
+			}
+		}
+
+		if !verified {
+			return fmt.Errorf("CRL %v is not signed by a trusted CA", r.crl)
+		}
+	}
+
+	revoked := map[string]int{}
+	for _, entry := range list.RevokedCertificateEntries {
+		revoked[serial(entry.SerialNumber.Bytes())] = entry.ReasonCode
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.list = list
+	r.revoked = revoked
+	r.modified = info.ModTime()
+	r.expired = false
+
+	infof("loaded CRL %v (%v revoked certificates, next update %v)", r.crl, len(revoked), list.NextUpdate.Format(time.RFC3339))
+
+	return nil
+}
+
+func (r *Revocation) reload() {
+	r.RLock()
+	modified := r.modified
+	r.RUnlock()
+
+	if info, err := os.Stat(r.crl); err != nil {
+		warnf("%v", err)
+	} else if !info.ModTime().Equal(modified) {
+		if err := r.load(); err != nil {
+			warnf("error reloading CRL (%v) - retaining previous revocation list", err)
+
+			r.Lock()
+			r.modified = info.ModTime()
+			r.Unlock()
+		}
+	}
+}
+
+// stale warns (once for each loaded CRL) if the CRL is past its next update time. The CRL is still
+// used because it is the most recent revocation information available.
+func (r *Revocation) stale() {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.list != nil && !r.expired && !r.list.NextUpdate.IsZero() && time.Now().After(r.list.NextUpdate) {
+		r.expired = true
+		warnf("CRL %v expired at %v - update the CRL file", r.crl, r.list.NextUpdate.Format(time.RFC3339))
+	}
+}
+
+func (r *Revocation) checkCRL(certificate *x509.Certificate) error {
+	r.RLock()
+	defer r.RUnlock()
+
+	if r.list == nil || !bytes.Equal(certificate.RawIssuer, r.list.RawIssuer) {
+		return nil
+	}
+
+	if reason, ok := r.revoked[serial(certificate.SerialNumber.Bytes())]; ok {
+		return fmt.Errorf("certificate '%v' (serial %v) revoked by CRL (%v)", certificate.Subject, certificate.SerialNumber, reasonf(reason))
+	}
+
+	return nil
+}
+
+func (r *Revocation) checkOCSP(certificate, issuer *x509.Certificate, stapled []byte) error {
+	var response *ocsp.Response
+	var err error
+
+	if len(stapled) > 0 {
+		if response, err = ocsp.ParseResponseForCert(stapled, certificate, issuer); err != nil {
+			warnf("invalid stapled OCSP response for '%v' (%v)", certificate.Subject, err)
+			response = nil
+		} else if !time.Now().Before(expiry(response)) {
+			warnf("stale stapled OCSP response for '%v' (produced %v)", certificate.Subject, response.ProducedAt.Format(time.RFC3339))
+			response = nil
+		}
+	}
+
+	if response == nil {
+		if response = r.lookup(certificate, issuer); response == nil {
+			return nil
+		}
+	}
+
+	switch response.Status {
+	case ocsp.Good:
+		return nil
+
+	case ocsp.Revoked:
+		return fmt.Errorf("certificate '%v' (serial %v) revoked by OCSP responder at %v (%v)",
+			certificate.Subject,
+			certificate.SerialNumber,
+			response.RevokedAt.Format(time.RFC3339),
+			reasonf(response.RevocationReason))
+
+	default:
+		warnf("OCSP status for certificate '%v' (serial %v) is unknown", certificate.Subject, certificate.SerialNumber)
+		return nil
+	}
+}
+
+// lookup returns the cached OCSP response for a peer certificate, refreshing it in the background
+// if it is due to expire. The OCSP responder is only queried on the handshake path if there is no
+// usable cached response and a previous query has not failed within the last OCSP_BACKOFF.
+func (r *Revocation) lookup(certificate, issuer *x509.Certificate) *ocsp.Response {
+	if len(certificate.OCSPServer) == 0 {
+		return nil
+	}
+
+	key := serial(certificate.SerialNumber.Bytes())
+	current, refresh := r.cached(r.responses, key)
+
+	switch {
+	case refresh && current != nil:
+		go r.refresh(r.responses, key, certificate, issuer)
+
+	case refresh:
+		r.refresh(r.responses, key, certificate, issuer)
+		current, _ = r.cached(r.responses, key)
+	}
+
+	if current != nil {
+		return current.response
+	}
+
+	return nil
+}
+
+// staple returns the last good OCSP staple for the server certificate (if any), starting a background
+// refresh if the staple is due to expire.
+func (r *Revocation) staple(certificate, issuer *x509.Certificate) []byte {
+	key := serial(certificate.SerialNumber.Bytes())
+
+	current, refresh := r.cached(r.staples, key)
+	if refresh {
+		go r.refresh(r.staples, key, certificate, issuer)
+	}
+
+	if current != nil {
+		return current.raw
+	}
+
+	return nil
+}
+
+// cached returns a copy of the cached OCSP response for the key if it has not expired and marks the
+// entry as refreshing if it is within OCSP_REFRESH of expiring and not in backoff after a failed query.
+func (r *Revocation) cached(m map[string]*cached, key string) (*cached, bool) {
+	now := time.Now()
+
+	r.Lock()
+	defer r.Unlock()
+
+	entry, ok := m[key]
+	if !ok {
+		entry = &cached{}
+		m[key] = entry
+	}
+
+	refresh := !entry.refreshing && !now.Before(entry.retry) && !now.Add(OCSP_REFRESH).Before(entry.expires)
+	if refresh {
+		entry.refreshing = true
+	}
+
+	if entry.response != nil && now.Before(entry.expires) {
+		current := *entry
+		return &current, refresh
+	}
+
+	return nil, refresh
+}
+
+// refresh queries the OCSP responder and updates the cached response. A failed query retains the
+// previous response until it expires and is not retried for OCSP_BACKOFF. The entries for other
+// certificates that have expired (and are not being refreshed or in backoff) are evicted.
+func (r *Revocation) refresh(m map[string]*cached, key string, certificate, issuer *x509.Certificate) {
+	raw, response, err := r.query(certificate, issuer)
+
+	r.Lock()
+	defer r.Unlock()
+
+	evict(m, time.Now())
+
+	entry := m[key]
+	entry.refreshing = false
+
+	if err != nil {
+		entry.retry = time.Now().Add(OCSP_BACKOFF)
+		warnf("OCSP query for '%v' failed (%v) - retrying in %v", certificate.Subject, err, OCSP_BACKOFF)
+		return
+	}
+
+	entry.raw = raw
+	entry.response = response
+	entry.expires = expiry(response)
+	entry.retry = time.Time{}
+
+	debugf("refreshed OCSP response for '%v' (expires %v)", certificate.Subject, entry.expires.Format(time.RFC3339))
+}
+
+func (r *Revocation) query(certificate, issuer *x509.Certificate) ([]byte, *ocsp.Response, error) {
+	request, err := ocsp.CreateRequest(certificate, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	url := certificate.OCSPServer[0]
+	rq, err := r.client.Post(url, "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rq.Body.Close()
+
+	if rq.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("OCSP responder %v returned %v", url, rq.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(rq.Body, 65536))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response, err := ocsp.ParseResponseForCert(b, certificate, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return b, response, nil
+}
+
+func (r *Revocation) issuer(certificate *x509.Certificate, keypair tls.Certificate) *x509.Certificate {
+	for _, b := range keypair.Certificate[1:] {
+		if c, err := x509.ParseCertificate(b); err == nil && certificate.CheckSignatureFrom(c) == nil {
+			return c
+		}
+	}
+
+	for _, c := range r.issuers {
+		if certificate.CheckSignatureFrom(c) == nil {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func evict(m map[string]*cached, now time.Time) {
+	for k, entry := range m {
+		if !entry.refreshing && !now.Before(entry.retry) && !now.Before(entry.expires) {
+			delete(m, k)
+		}
+	}
+}
+
+// expiry returns the time after which an OCSP response should no longer be used i.e. the NextUpdate
+// time or OCSP_LIFETIME after ThisUpdate for a response without a NextUpdate time.
+func expiry(response *ocsp.Response) time.Time {
+	if !response.NextUpdate.IsZero() {
+		return response.NextUpdate
+	}
+
+	return response.ThisUpdate.Add(OCSP_LIFETIME)
+}
+
+func serial(b []byte) string {
+	return hex.EncodeToString(b)
+}
+
+func reasonf(code int) string {
+	if reason, ok := reasons[code]; ok {
+		return reason
+	}
+
+	return fmt.Sprintf("reason code %v", code)
+}
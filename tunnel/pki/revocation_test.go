@@ -0,0 +1,323 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRevocationWithCRL(t *testing.T) {
+	ca, key := testCA(t)
+	good := testCertificate(t, ca, key, 1001)
+	revoked := testCertificate(t, ca, key, 1002)
+
+	crl := filepath.Join(t.TempDir(), "tunnel.crl")
+	template := x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(24 * time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(1002), RevocationTime: time.Now(), ReasonCode: 1},
+		},
+	}
+
+	if b, err := x509.CreateRevocationList(rand.Reader, &template, ca, key); err != nil {
+		t.Fatalf("error creating CRL (%v)", err)
+	} else if err := os.WriteFile(crl, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: b}), 0600); err != nil {
+		t.Fatalf("error writing CRL (%v)", err)
+	}
+
+	r, err := NewRevocation(crl, false, []*x509.Certificate{ca})
+	if err != nil {
+		t.Fatalf("error creating revocation checker (%v)", err)
+	}
+
+	if err := r.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{good, ca}}}); err != nil {
+		t.Errorf("valid certificate rejected (%v)", err)
+	}
+
+	if err := r.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{revoked, ca}}}); err == nil {
+		t.Errorf("revoked certificate accepted")
+	}
+}
+
+func TestRevocationWithoutCRLOrOCSP(t *testing.T) {
+	if r, err := NewRevocation("", false, nil); err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	} else if r != nil {
+		t.Errorf("expected nil revocation checker, got %v", r)
+	}
+}
+
+func TestRevocationWithStapledOCSPResponse(t *testing.T) {
+	ca, key := testCA(t)
+	certificate := testCertificate(t, ca, key, 1003)
+
+	tests := []struct {
+		thisUpdate time.Time
+		nextUpdate time.Time
+		revoked    bool
+	}{
+		{time.Now().Add(-time.Hour), time.Now().Add(time.Hour), true},
+		{time.Now().Add(-2 * time.Hour), time.Now().Add(-time.Hour), false},
+		{time.Now().Add(-time.Hour), time.Time{}, true},
+		{time.Now().Add(-OCSP_LIFETIME - time.Hour), time.Time{}, false},
+	}
+
+	r, err := NewRevocation("", true, []*x509.Certificate{ca})
+	if err != nil {
+		t.Fatalf("error creating revocation checker (%v)", err)
+	}
+
+	for _, v := range tests {
+		stapled := testOCSPResponse(t, ca, key, certificate, ocsp.Revoked, v.thisUpdate, v.nextUpdate)
+		cs := tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{certificate, ca}},
+			OCSPResponse:   stapled,
+		}
+
+		if err := r.VerifyConnection(cs); v.revoked && err == nil {
+			t.Errorf("revoked certificate accepted with stapled OCSP response %v..%v", v.thisUpdate, v.nextUpdate)
+		} else if !v.revoked && err != nil {
+			t.Errorf("stale stapled OCSP response %v..%v not ignored (%v)", v.thisUpdate, v.nextUpdate, err)
+		}
+	}
+}
+
+func TestRevocationWithFailedOCSPQuery(t *testing.T) {
+	var queries atomic.Int32
+
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		queries.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	defer responder.Close()
+
+	ca, key := testCA(t)
+	certificate := testCertificate(t, ca, key, 1004, responder.URL)
+
+	r, err := NewRevocation("", true, []*x509.Certificate{ca})
+	if err != nil {
+		t.Fatalf("error creating revocation checker (%v)", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := r.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate, ca}}}); err != nil {
+			t.Errorf("unexpected error (%v)", err)
+		}
+	}
+
+	if n := queries.Load(); n != 1 {
+		t.Errorf("incorrect number of OCSP queries - expected:%v, got:%v", 1, n)
+	}
+}
+
+func TestOCSPStapling(t *testing.T) {
+	var queries atomic.Int32
+	var response []byte
+
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		queries.Add(1)
+		w.Write(response)
+	}))
+
+	defer responder.Close()
+
+	ca, key := testCA(t)
+	certificate := testCertificate(t, ca, key, 1005, responder.URL)
+	response = testOCSPResponse(t, ca, key, certificate, ocsp.Good, time.Now().Add(-time.Minute), time.Time{})
+
+	r, err := NewRevocation("", true, []*x509.Certificate{ca})
+	if err != nil {
+		t.Fatalf("error creating revocation checker (%v)", err)
+	}
+
+	get := r.GetCertificate(tls.Certificate{Certificate: [][]byte{certificate.Raw, ca.Raw}})
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if c, err := get(&tls.ClientHelloInfo{}); err != nil {
+			t.Fatalf("unexpected error (%v)", err)
+		} else if len(c.OCSPStaple) > 0 {
+			break
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if c, err := get(&tls.ClientHelloInfo{}); err != nil {
+			t.Fatalf("unexpected error (%v)", err)
+		} else if !bytes.Equal(c.OCSPStaple, response) {
+			t.Errorf("incorrect OCSP staple")
+		}
+	}
+
+	if n := queries.Load(); n != 1 {
+		t.Errorf("incorrect number of OCSP queries - expected:%v, got:%v", 1, n)
+	}
+}
+
+func TestOCSPStaplingWithDynamicCertificate(t *testing.T) {
+	var response []byte
+
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		w.Write(response)
+	}))
+
+	defer responder.Close()
+
+	ca, key := testCA(t)
+	certificate := testCertificate(t, ca, key, 1006, responder.URL)
+	response = testOCSPResponse(t, ca, key, certificate, ocsp.Good, time.Now().Add(-time.Minute), time.Now().Add(24*time.Hour))
+
+	r, err := NewRevocation("", true, []*x509.Certificate{ca})
+	if err != nil {
+		t.Fatalf("error creating revocation checker (%v)", err)
+	}
+
+	keypair := tls.Certificate{Certificate: [][]byte{certificate.Raw, ca.Raw}}
+	get := r.Staple(func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &keypair, nil
+	})
+
+	var stapled []byte
+	for start := time.Now(); time.Since(start) < 5*time.Second && len(stapled) == 0; time.Sleep(10 * time.Millisecond) {
+		if c, err := get(&tls.ClientHelloInfo{}); err != nil {
+			t.Fatalf("unexpected error (%v)", err)
+		} else {
+			stapled = c.OCSPStaple
+		}
+	}
+
+	if !bytes.Equal(stapled, response) {
+		t.Errorf("incorrect OCSP staple")
+	}
+
+	if len(keypair.OCSPStaple) != 0 {
+		t.Errorf("original certificate modified")
+	}
+}
+
+func TestOCSPCacheEviction(t *testing.T) {
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	defer responder.Close()
+
+	ca, key := testCA(t)
+	certificate := testCertificate(t, ca, key, 1007, responder.URL)
+
+	r, err := NewRevocation("", true, []*x509.Certificate{ca})
+	if err != nil {
+		t.Fatalf("error creating revocation checker (%v)", err)
+	}
+
+	now := time.Now()
+	r.responses["expired"] = &cached{expires: now.Add(-time.Minute)}
+	r.responses["backoff"] = &cached{retry: now.Add(time.Minute)}
+	r.responses["refreshing"] = &cached{refreshing: true}
+	r.responses["current"] = &cached{expires: now.Add(time.Hour)}
+
+	r.VerifyConnection(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate, ca}}})
+
+	for _, k := range []string{"backoff", "refreshing", "current", serial(certificate.SerialNumber.Bytes())} {
+		if _, ok := r.responses[k]; !ok {
+			t.Errorf("cached OCSP response '%v' evicted", k)
+		}
+	}
+
+	if _, ok := r.responses["expired"]; ok {
+		t.Errorf("expired OCSP response not evicted")
+	}
+}
+
+func testOCSPResponse(t *testing.T, ca *x509.Certificate, key *ecdsa.PrivateKey, certificate *x509.Certificate, status int, thisUpdate, nextUpdate time.Time) []byte {
+	template := ocsp.Response{
+		Status:           status,
+		SerialNumber:     certificate.SerialNumber,
+		ThisUpdate:       thisUpdate,
+		NextUpdate:       nextUpdate,
+		RevokedAt:        thisUpdate,
+		RevocationReason: ocsp.KeyCompromise,
+	}
+
+	b, err := ocsp.CreateResponse(ca, ca, template, key)
+	if err != nil {
+		t.Fatalf("error creating OCSP response (%v)", err)
+	}
+
+	return b
+}
+
+func testCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "uhppoted-tunnel CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ca, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return ca, key
+}
+
+func testCertificate(t *testing.T, ca *x509.Certificate, cakey *ecdsa.PrivateKey, serial int64, responders ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		OCSPServer:   responders,
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, &template, ca, &key.PublicKey, cakey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	certificate, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return certificate
+}
@@ -0,0 +1,122 @@
+package psk
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// conn wraps a net.Conn with length prefixed ChaCha20-Poly1305 frames. The nonce for each frame is
+// the (implicit) frame sequence number in each direction.
+type conn struct {
+	net.Conn
+	tx struct {
+		aead cipher.AEAD
+		seq  uint64
+		sync.Mutex
+	}
+	rx struct {
+		aead    cipher.AEAD
+		seq     uint64
+		pending []byte
+		sync.Mutex
+	}
+}
+
+const MAX_FRAME = 16384
+
+func newConn(c net.Conn, txkey, rxkey []byte) (*conn, error) {
+	tx, err := chacha20poly1305.New(txkey)
+	if err != nil {
+		return nil, err
+	}
+
+	rx, err := chacha20poly1305.New(rxkey)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := conn{
+		Conn: c,
+	}
+
+	cc.tx.aead = tx
+	cc.rx.aead = rx
+
+	return &cc, nil
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	c.tx.Lock()
+	defer c.tx.Unlock()
+
+	N := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > MAX_FRAME {
+			chunk = b[:MAX_FRAME]
+		}
+
+		if c.tx.seq == math.MaxUint64 {
+			return N, fmt.Errorf("PSK frame sequence exhausted")
+		}
+
+		header := make([]byte, 2)
+		binary.BigEndian.PutUint16(header, uint16(len(chunk)+c.tx.aead.Overhead()))
+
+		frame := c.tx.aead.Seal(header, nonce(c.tx.seq), chunk, header)
+		c.tx.seq++
+
+		if _, err := c.Conn.Write(frame); err != nil {
+			return N, err
+		}
+
+		N += len(chunk)
+		b = b[len(chunk):]
+	}
+
+	return N, nil
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.rx.Lock()
+	defer c.rx.Unlock()
+
+	if len(c.rx.pending) == 0 {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(c.Conn, header); err != nil {
+			return 0, err
+		}
+
+		frame := make([]byte, binary.BigEndian.Uint16(header))
+		if _, err := io.ReadFull(c.Conn, frame); err != nil {
+			return 0, err
+		}
+
+		plaintext, err := c.rx.aead.Open(frame[:0], nonce(c.rx.seq), frame, header)
+		if err != nil {
+			return 0, fmt.Errorf("PSK frame %v failed authentication", c.rx.seq)
+		}
+
+		c.rx.seq++
+		c.rx.pending = plaintext
+	}
+
+	N := copy(b, c.rx.pending)
+	c.rx.pending = c.rx.pending[N:]
+
+	return N, nil
+}
+
+func nonce(seq uint64) []byte {
+	n := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(n[4:], seq)
+
+	return n
+}
@@ -0,0 +1,210 @@
+package psk
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Key is a pre-shared key used to mutually authenticate TCP tunnel connections and derive the
+// per-connection session keys.
+//
+// The handshake exchanges ephemeral X25519 public keys authenticated with an HMAC keyed from the
+// pre-shared key and derives a pair of directional ChaCha20-Poly1305 session keys from the ECDH
+// shared secret, the pre-shared key and the handshake transcript. Frames are encrypted with an
+// implicit sequence number nonce, so replayed, reordered or modified frames fail authentication.
+type Key struct {
+	auth    []byte
+	salt    []byte
+	timeout time.Duration
+}
+
+const (
+	PROTOCOL       = "uhppoted-tunnel-psk-v1"
+	MIN_KEY_LENGTH = 16
+	HANDSHAKE_SIZE = 32 + sha256.Size
+)
+
+// NewKey loads a pre-shared key from a file ('file:<path>' or just '<path>') or environment
+// variable ('env:<variable>'). A key of 64 hexadecimal digits is decoded as a 256-bit key,
+// otherwise the key is used as is and must be at least 16 bytes long.
+func NewKey(spec string) (*Key, error) {
+	var secret string
+
+	switch {
+	case spec == "":
+		return nil, nil
+
+	case strings.HasPrefix(spec, "env:"):
+		if v, ok := os.LookupEnv(spec[4:]); !ok {
+			return nil, fmt.Errorf("PSK environment variable %v not defined", spec[4:])
+		} else {
+			secret = v
+		}
+
+	default:
+		file := strings.TrimPrefix(spec, "file:")
+		if b, err := os.ReadFile(file); err != nil {
+			return nil, err
+		} else {
+			secret = string(b)
+		}
+	}
+
+	key := []byte(strings.TrimSpace(secret))
+	if len(key) == 64 {
+		if b, err := hex.DecodeString(string(key)); err == nil {
+			key = b
+		}
+	}
+
+	if len(key) < MIN_KEY_LENGTH {
+		return nil, fmt.Errorf("PSK is too short (minimum %v bytes)", MIN_KEY_LENGTH)
+	}
+
+	auth := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte(PROTOCOL+" auth")), auth); err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		auth:    auth,
+		salt:    key,
+		timeout: 5 * time.Second,
+	}, nil
+}
+
+// Client performs the initiator side of the handshake and returns the encrypted connection. The
+// connection is closed if the handshake fails.
+func (k *Key) Client(c net.Conn) (net.Conn, error) {
+	if k == nil {
+		return c, nil
+	}
+
+	if cc, err := k.handshake(c, true); err != nil {
+		c.Close()
+		return nil, err
+	} else {
+		return cc, nil
+	}
+}
+
+// Server performs the responder side of the handshake and returns the encrypted connection. The
+// connection is closed if the handshake fails.
+func (k *Key) Server(c net.Conn) (net.Conn, error) {
+	if k == nil {
+		return c, nil
+	}
+
+	if cc, err := k.handshake(c, false); err != nil {
+		c.Close()
+		return nil, err
+	} else {
+		return cc, nil
+	}
+}
+
+func (k *Key) handshake(c net.Conn, initiator bool) (*conn, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.SetDeadline(time.Now().Add(k.timeout)); err != nil {
+		return nil, err
+	}
+
+	defer c.SetDeadline(time.Time{})
+
+	local := ephemeral.PublicKey().Bytes()
+	var remote []byte
+
+	if initiator {
+		if err := k.write(c, local, nil); err != nil {
+			return nil, err
+		} else if remote, err = k.read(c, local); err != nil {
+			return nil, err
+		}
+	} else {
+		if remote, err = k.read(c, nil); err != nil {
+			return nil, err
+		} else if err := k.write(c, local, remote); err != nil {
+			return nil, err
+		}
+	}
+
+	peer, err := ecdh.X25519().NewPublicKey(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := ephemeral.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	transcript := []byte(PROTOCOL)
+	if initiator {
+		transcript = append(append(transcript, local...), remote...)
+	} else {
+		transcript = append(append(transcript, remote...), local...)
+	}
+
+	keys := make([]byte, 64)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, k.salt, transcript), keys); err != nil {
+		return nil, err
+	}
+
+	if initiator {
+		return newConn(c, keys[:32], keys[32:])
+	} else {
+		return newConn(c, keys[32:], keys[:32])
+	}
+}
+
+// write sends the local ephemeral public key and the HMAC over the public key and, for the
+// responder, the initiator's public key.
+func (k *Key) write(c net.Conn, local, remote []byte) error {
+	mac := hmac.New(sha256.New, k.auth)
+	mac.Write(remote)
+	mac.Write(local)
+
+	message := append(append([]byte{}, local...), mac.Sum(nil)...)
+
+	if _, err := c.Write(message); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// read receives the remote ephemeral public key and verifies the HMAC.
+func (k *Key) read(c net.Conn, local []byte) ([]byte, error) {
+	message := make([]byte, HANDSHAKE_SIZE)
+
+	if _, err := io.ReadFull(c, message); err != nil {
+		return nil, fmt.Errorf("PSK handshake failed (%v)", err)
+	}
+
+	remote := message[:32]
+
+	mac := hmac.New(sha256.New, k.auth)
+	mac.Write(local)
+	mac.Write(remote)
+
+	if !hmac.Equal(mac.Sum(nil), message[32:]) {
+		return nil, fmt.Errorf("PSK handshake failed - invalid key")
+	}
+
+	return remote, nil
+}
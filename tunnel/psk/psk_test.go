@@ -0,0 +1,80 @@
+package psk
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandshake(t *testing.T) {
+	key := testKey(t, "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	a, b := net.Pipe()
+
+	defer a.Close()
+	defer b.Close()
+
+	ch := make(chan net.Conn)
+	go func() {
+		if c, err := key.Server(b); err != nil {
+			t.Errorf("server handshake failed (%v)", err)
+			ch <- nil
+		} else {
+			ch <- c
+		}
+	}()
+
+	client, err := key.Client(a)
+	if err != nil {
+		t.Fatalf("client handshake failed (%v)", err)
+	}
+
+	server := <-ch
+	if server == nil {
+		t.FailNow()
+	}
+
+	message := []byte{0x00, 0x40, 0x00, 0x00, 0x00, 0x01, 0x17, 0x94}
+
+	go client.Write(message)
+
+	reply := make([]byte, 64)
+	if N, err := server.Read(reply); err != nil {
+		t.Fatalf("error reading message (%v)", err)
+	} else if !bytes.Equal(reply[:N], message) {
+		t.Errorf("incorrect message - expected:%v, got:%v", message, reply[:N])
+	}
+}
+
+func TestHandshakeWithMismatchedKeys(t *testing.T) {
+	p := testKey(t, "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	q := testKey(t, "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210")
+	a, b := net.Pipe()
+
+	defer a.Close()
+	defer b.Close()
+
+	go func() {
+		q.Server(b)
+		b.Close()
+	}()
+
+	if _, err := p.Client(a); err == nil {
+		t.Errorf("expected handshake with mismatched keys to fail")
+	}
+}
+
+func testKey(t *testing.T, secret string) *Key {
+	file := filepath.Join(t.TempDir(), "tunnel.psk")
+	if err := os.WriteFile(file, []byte(secret), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	key, err := NewKey("file:" + file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return key
+}
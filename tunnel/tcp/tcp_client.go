@@ -11,12 +11,14 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/psk"
 )
 
 type tcpClient struct {
 	conn.Conn
 	hwif    string
 	addr    *net.TCPAddr
+	psk     *psk.Key
 	retry   conn.Backoff
 	timeout time.Duration
 	ch      chan protocol.Message
@@ -24,8 +26,8 @@ type tcpClient struct {
 	closed  chan struct{}
 }
 
-func NewTCPInClient(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpClient, error) {
-	client, err := makeTCPClient(hwif, spec, retry, ctx)
+func NewTCPInClient(hwif string, spec string, key *psk.Key, retry conn.Backoff, ctx context.Context) (*tcpClient, error) {
+	client, err := makeTCPClient(hwif, spec, key, retry, ctx)
 
 	if err == nil {
 		client.Infof("connector::tcp-client-in")
@@ -34,8 +36,8 @@ func NewTCPInClient(hwif string, spec string, retry conn.Backoff, ctx context.Co
 	return client, err
 }
 
-func NewTCPOutClient(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpClient, error) {
-	client, err := makeTCPClient(hwif, spec, retry, ctx)
+func NewTCPOutClient(hwif string, spec string, key *psk.Key, retry conn.Backoff, ctx context.Context) (*tcpClient, error) {
+	client, err := makeTCPClient(hwif, spec, key, retry, ctx)
 
 	if err == nil {
 		client.Infof("connector::tcp-client-out")
@@ -44,7 +46,7 @@ func NewTCPOutClient(hwif string, spec string, retry conn.Backoff, ctx context.C
 	return client, err
 }
 
-func makeTCPClient(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpClient, error) {
+func makeTCPClient(hwif string, spec string, key *psk.Key, retry conn.Backoff, ctx context.Context) (*tcpClient, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 	if err != nil {
 		return nil, err
@@ -58,6 +60,7 @@ func makeTCPClient(hwif string, spec string, retry conn.Backoff, ctx context.Con
 		},
 		hwif:    hwif,
 		addr:    addr,
+		psk:     key,
 		retry:   retry,
 		timeout: 5 * time.Second,
 		ch:      make(chan protocol.Message, 16),
@@ -114,6 +117,8 @@ func (tcp *tcpClient) connect(router *router.Switch) {
 			tcp.Warnf("%v", err)
 		} else if socket == nil {
 			tcp.Warnf("connect %v failed (%v)", tcp.addr, socket)
+		} else if socket, err := tcp.psk.Client(socket); err != nil {
+			tcp.Warnf("%v", err)
 		} else {
 			tcp.retry.Reset()
 			eof := make(chan struct{})
@@ -11,12 +11,14 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/psk"
 )
 
 type tcpEventClient struct {
 	conn.Conn
 	hwif    string
 	addr    *net.TCPAddr
+	psk     *psk.Key
 	retry   conn.Backoff
 	timeout time.Duration
 	ch      chan protocol.Message
@@ -73,6 +75,8 @@ func (tcp *tcpEventClient) connect(router *router.Switch) {
 			tcp.Warnf("%v", err)
 		} else if socket == nil {
 			tcp.Warnf("connect %v failed (%v)", tcp.addr, socket)
+		} else if socket, err := tcp.psk.Client(socket); err != nil {
+			tcp.Warnf("%v", err)
 		} else {
 			tcp.retry.Reset()
 			eof := make(chan struct{})
@@ -9,13 +9,14 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/psk"
 )
 
 type tcpEventInClient struct {
 	tcpEventClient
 }
 
-func NewTCPEventInClient(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpEventInClient, error) {
+func NewTCPEventInClient(hwif string, spec string, key *psk.Key, retry conn.Backoff, ctx context.Context) (*tcpEventInClient, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 	if err != nil {
 		return nil, err
@@ -30,6 +31,7 @@ func NewTCPEventInClient(hwif string, spec string, retry conn.Backoff, ctx conte
 			},
 			hwif:    hwif,
 			addr:    addr,
+			psk:     key,
 			retry:   retry,
 			timeout: 5 * time.Second,
 			ch:      make(chan protocol.Message, 16),
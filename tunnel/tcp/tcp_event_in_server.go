@@ -8,13 +8,14 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/psk"
 )
 
 type tcpEventIn struct {
 	tcpEventServer
 }
 
-func NewTCPEventInServer(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpEventIn, error) {
+func NewTCPEventInServer(hwif string, spec string, key *psk.Key, retry conn.Backoff, ctx context.Context) (*tcpEventIn, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 
 	if err != nil {
@@ -32,6 +33,7 @@ func NewTCPEventInServer(hwif string, spec string, retry conn.Backoff, ctx conte
 			},
 			hwif:        hwif,
 			addr:        addr,
+			psk:         key,
 			retry:       retry,
 			connections: map[net.Conn]struct{}{},
 			ctx:         ctx,
@@ -9,13 +9,14 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/psk"
 )
 
 type tcpEventOutClient struct {
 	tcpEventClient
 }
 
-func NewTCPEventOutClient(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpEventOutClient, error) {
+func NewTCPEventOutClient(hwif string, spec string, key *psk.Key, retry conn.Backoff, ctx context.Context) (*tcpEventOutClient, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 	if err != nil {
 		return nil, err
@@ -30,6 +31,7 @@ func NewTCPEventOutClient(hwif string, spec string, retry conn.Backoff, ctx cont
 			},
 			hwif:    hwif,
 			addr:    addr,
+			psk:     key,
 			retry:   retry,
 			timeout: 5 * time.Second,
 			ch:      make(chan protocol.Message, 16),
@@ -8,13 +8,14 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/psk"
 )
 
 type tcpEventOutServer struct {
 	tcpEventServer
 }
 
-func NewTCPEventOutServer(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpEventOutServer, error) {
+func NewTCPEventOutServer(hwif string, spec string, key *psk.Key, retry conn.Backoff, ctx context.Context) (*tcpEventOutServer, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 
 	if err != nil {
@@ -32,6 +33,7 @@ func NewTCPEventOutServer(hwif string, spec string, retry conn.Backoff, ctx cont
 			},
 			hwif:        hwif,
 			addr:        addr,
+			psk:         key,
 			retry:       retry,
 			connections: map[net.Conn]struct{}{},
 			ctx:         ctx,
@@ -13,12 +13,14 @@ import (
 	// "github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/psk"
 )
 
 type tcpEventServer struct {
 	conn.Conn
 	hwif        string
 	addr        *net.TCPAddr
+	psk         *psk.Key
 	retry       conn.Backoff
 	connections map[net.Conn]struct{}
 	ctx         context.Context
@@ -107,33 +109,45 @@ func (tcp *tcpEventServer) listen(socket net.Listener, router *router.Switch) {
 
 		tcp.Infof("incoming connection (%v)", client.RemoteAddr())
 
-		if socket, ok := client.(*net.TCPConn); !ok {
-			tcp.Warnf("invalid TCP socket (%v)", socket)
-			client.Close()
-		} else {
-			tcp.Lock()
-			tcp.connections[socket] = struct{}{}
-			tcp.Unlock()
-
-			go func(socket *net.TCPConn) {
-				for {
-					buffer := make([]byte, 2048) // buffer is handed off to router
-					if N, err := socket.Read(buffer); err != nil {
-						if err == io.EOF {
-							tcp.Infof("client connection %v closed ", socket.RemoteAddr())
-						} else {
-							tcp.Warnf("%v", err)
-						}
-						break
-					} else {
-						tcp.received(buffer[:N], router, socket)
-					}
-				}
+		go tcp.serve(client, router)
+	}
+}
+
+// serve runs the PSK handshake (if any) and then relays the events received on the connection. It is
+// invoked as a goroutine for each connection so that a stalled handshake does not block the listener.
+func (tcp *tcpEventServer) serve(client net.Conn, router *router.Switch) {
+	if _, ok := client.(*net.TCPConn); !ok {
+		tcp.Warnf("invalid TCP socket (%v)", client)
+		client.Close()
+		return
+	}
+
+	socket, err := tcp.psk.Server(client)
+	if err != nil {
+		tcp.Warnf("%v", err)
+		client.Close()
+		return
+	}
+
+	tcp.Lock()
+	tcp.connections[socket] = struct{}{}
+	tcp.Unlock()
 
-				tcp.Lock()
-				delete(tcp.connections, socket)
-				tcp.Unlock()
-			}(socket)
+	for {
+		buffer := make([]byte, 2048) // buffer is handed off to router
+		if N, err := socket.Read(buffer); err != nil {
+			if err == io.EOF {
+				tcp.Infof("client connection %v closed ", socket.RemoteAddr())
+			} else {
+				tcp.Warnf("%v", err)
+			}
+			break
+		} else {
+			tcp.received(buffer[:N], router, socket)
 		}
 	}
+
+	tcp.Lock()
+	delete(tcp.connections, socket)
+	tcp.Unlock()
 }
@@ -13,12 +13,14 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/psk"
 )
 
 type tcpServer struct {
 	conn.Conn
 	hwif        string
 	addr        *net.TCPAddr
+	psk         *psk.Key
 	retry       conn.Backoff
 	connections map[net.Conn]struct{}
 	ctx         context.Context
@@ -27,8 +29,8 @@ type tcpServer struct {
 	sync.RWMutex
 }
 
-func NewTCPInServer(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpServer, error) {
-	server, err := makeTCPServer(hwif, spec, retry, ctx)
+func NewTCPInServer(hwif string, spec string, key *psk.Key, retry conn.Backoff, ctx context.Context) (*tcpServer, error) {
+	server, err := makeTCPServer(hwif, spec, key, retry, ctx)
 
 	if err == nil {
 		server.Infof("connector::tcp-server-in")
@@ -37,8 +39,8 @@ func NewTCPInServer(hwif string, spec string, retry conn.Backoff, ctx context.Co
 	return server, err
 }
 
-func NewTCPOutServer(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpServer, error) {
-	server, err := makeTCPServer(hwif, spec, retry, ctx)
+func NewTCPOutServer(hwif string, spec string, key *psk.Key, retry conn.Backoff, ctx context.Context) (*tcpServer, error) {
+	server, err := makeTCPServer(hwif, spec, key, retry, ctx)
 
 	if err == nil {
 		server.Infof("connector::tcp-server-out")
@@ -47,7 +49,7 @@ func NewTCPOutServer(hwif string, spec string, retry conn.Backoff, ctx context.C
 	return server, err
 }
 
-func makeTCPServer(hwif string, spec string, retry conn.Backoff, ctx context.Context) (*tcpServer, error) {
+func makeTCPServer(hwif string, spec string, key *psk.Key, retry conn.Backoff, ctx context.Context) (*tcpServer, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 
 	if err != nil {
@@ -64,6 +66,7 @@ func makeTCPServer(hwif string, spec string, retry conn.Backoff, ctx context.Con
 		},
 		hwif:        hwif,
 		addr:        addr,
+		psk:         key,
 		retry:       retry,
 		connections: map[net.Conn]struct{}{},
 		ctx:         ctx,
@@ -161,37 +164,50 @@ func (tcp *tcpServer) listen(socket net.Listener, router *router.Switch) {
 
 		tcp.Infof("incoming connection (%v)", client.RemoteAddr())
 
-		if socket, ok := client.(*net.TCPConn); !ok {
-			tcp.Warnf("invalid TCP socket (%v)", socket)
-			client.Close()
-		} else {
-			tcp.Lock()
-			tcp.connections[socket] = struct{}{}
-			tcp.Unlock()
-
-			go func(socket *net.TCPConn) {
-				for {
-					buffer := make([]byte, 2048) // buffer is handed off to router
-					if N, err := socket.Read(buffer); err != nil {
-						if err == io.EOF {
-							tcp.Infof("client connection %v closed ", socket.RemoteAddr())
-						} else if tcp.closing {
-							tcp.Infof("shutdown client connection %v", socket.RemoteAddr())
-						} else {
-							tcp.Warnf("%v", err)
-						}
-						break
-					} else {
-						tcp.received(buffer[:N], router, socket)
-					}
-				}
+		go tcp.serve(client, router)
+	}
+}
 
-				tcp.Lock()
-				delete(tcp.connections, socket)
-				tcp.Unlock()
-			}(socket)
+// serve completes the PSK handshake (if any) for an incoming connection and then relays the received
+// messages until the connection is closed. The handshake is run here rather than in the accept loop
+// so that a client that stalls the handshake does not block other connections.
+func (tcp *tcpServer) serve(client net.Conn, router *router.Switch) {
+	if _, ok := client.(*net.TCPConn); !ok {
+		tcp.Warnf("invalid TCP socket (%v)", client)
+		client.Close()
+		return
+	}
+
+	socket, err := tcp.psk.Server(client)
+	if err != nil {
+		tcp.Warnf("%v", err)
+		client.Close()
+		return
+	}
+
+	tcp.Lock()
+	tcp.connections[socket] = struct{}{}
+	tcp.Unlock()
+
+	for {
+		buffer := make([]byte, 2048) // buffer is handed off to router
+		if N, err := socket.Read(buffer); err != nil {
+			if err == io.EOF {
+				tcp.Infof("client connection %v closed ", socket.RemoteAddr())
+			} else if tcp.closing {
+				tcp.Infof("shutdown client connection %v", socket.RemoteAddr())
+			} else {
+				tcp.Warnf("%v", err)
+			}
+			break
+		} else {
+			tcp.received(buffer[:N], router, socket)
 		}
 	}
+
+	tcp.Lock()
+	delete(tcp.connections, socket)
+	tcp.Unlock()
 }
 
 func (tcp *tcpServer) received(buffer []byte, router *router.Switch, socket net.Conn) {
@@ -0,0 +1,207 @@
+package timesync
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	codec "github.com/uhppoted/uhppote-core/encoding/UTO311-L0x"
+	"github.com/uhppoted/uhppote-core/messages"
+	"github.com/uhppoted/uhppote-core/types"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// timesync wraps an OUT connector with a scheduled task that sets the time on the controllers in the
+// TOML [controllers] table from the host clock, in the controller timezone (defaults to the host
+// timezone). The controller time is retrieved first and the time is only set if the controller has
+// drifted by at least MIN_DRIFT. The replies to the get-time and set-time requests are discarded after
+// they have been processed because there is no client waiting for them.
+type timesync struct {
+	conn.Conn
+	out         tunnel.Conn
+	interval    time.Duration
+	controllers map[uint32]conn.Controller
+	timeout     time.Duration
+	pending     map[uint32]chan []byte
+	ctx         context.Context
+	sync.Mutex
+}
+
+const MIN_DRIFT = 1 * time.Second
+const STARTUP_DELAY = 5 * time.Second
+
+// NewTimeSync wraps an OUT connector with a time synchronisation task that runs every interval.
+func NewTimeSync(out tunnel.Conn, interval time.Duration, controllers map[uint32]conn.Controller, timeout time.Duration, ctx context.Context) *timesync {
+	t := timesync{
+		Conn: conn.Conn{
+			Tag: "TIMESYNC",
+		},
+		out:         out,
+		interval:    interval,
+		controllers: controllers,
+		timeout:     timeout,
+		pending:     map[uint32]chan []byte{},
+		ctx:         ctx,
+	}
+
+	t.Infof("synchronising controller time every %v", interval)
+
+	if len(controllers) == 0 {
+		t.Warnf("no controllers in the [controllers] table")
+	}
+
+	return &t
+}
+
+func (t *timesync) Close() {
+	t.out.Close()
+}
+
+func (t *timesync) Run(router *router.Switch) error {
+	filtered := router.Filter(t.received)
+
+	go t.run()
+
+	return t.out.Run(&filtered)
+}
+
+func (t *timesync) Send(id uint32, message []byte) {
+	t.out.Send(id, message)
+}
+
+func (t *timesync) run() {
+	delay := time.NewTimer(STARTUP_DELAY)
+	defer delay.Stop()
+
+	select {
+	case <-t.ctx.Done():
+		return
+	case <-delay.C:
+		t.sync()
+	}
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+			t.sync()
+		}
+	}
+}
+
+func (t *timesync) sync() {
+	// ... discard the requests from the previous run that did not receive a reply
+	t.Lock()
+	clear(t.pending)
+	t.Unlock()
+
+	for _, controller := range slices.Sorted(maps.Keys(t.controllers)) {
+		location := t.controllers[controller].Location
+		if location == nil {
+			location = time.Local
+		}
+
+		if err := t.synchronise(controller, location); err != nil && t.ctx.Err() == nil {
+			t.Warnf("controller %v  %v", controller, err)
+		}
+	}
+}
+
+// synchronise retrieves the controller time and sets the controller time to the host time if the
+// controller has drifted.
+func (t *timesync) synchronise(controller uint32, location *time.Location) error {
+	get := messages.GetTimeResponse{}
+	if err := t.exchange(&messages.GetTimeRequest{SerialNumber: types.SerialNumber(controller)}, &get); err != nil {
+		return fmt.Errorf("get-time failed (%v)", err)
+	}
+
+	// ... controller time has a resolution of 1 second
+	now := time.Now().In(location).Truncate(time.Second)
+	ct := time.Time(get.DateTime)
+	ct = time.Date(ct.Year(), ct.Month(), ct.Day(), ct.Hour(), ct.Minute(), ct.Second(), 0, location)
+	drift := ct.Sub(now)
+
+	if drift.Abs() < MIN_DRIFT {
+		t.Debugf("controller %v  in sync (%v)", controller, location)
+		return nil
+	}
+
+	set := messages.SetTimeResponse{}
+	rq := messages.SetTimeRequest{
+		SerialNumber: types.SerialNumber(controller),
+		DateTime:     types.DateTime(time.Now().In(location).Truncate(time.Second)),
+	}
+
+	if err := t.exchange(&rq, &set); err != nil {
+		return fmt.Errorf("set-time failed (%v)", err)
+	}
+
+	t.Infof("controller %v  corrected drift of %v (%v %v)", controller, drift, set.DateTime, location)
+
+	return nil
+}
+
+// exchange sends a request to the controller via the wrapped connector and waits for the reply. The
+// request ID is retained after a timeout so that a late reply is discarded rather than relayed to the
+// IN connector.
+func (t *timesync) exchange(request any, reply any) error {
+	message, err := codec.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	id := protocol.NextID()
+	ch := make(chan []byte, 1)
+
+	t.Lock()
+	t.pending[id] = ch
+	t.Unlock()
+
+	timeout := time.NewTimer(conn.Timeout(message, t.controllers, t.timeout))
+	defer timeout.Stop()
+
+	go t.out.Send(id, message)
+
+	select {
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+
+	case <-timeout.C:
+		return fmt.Errorf("no reply")
+
+	case bytes := <-ch:
+		t.Lock()
+		delete(t.pending, id)
+		t.Unlock()
+
+		return codec.Unmarshal(bytes, reply)
+	}
+}
+
+func (t *timesync) received(id uint32, message []byte) []byte {
+	t.Lock()
+	ch, ok := t.pending[id]
+	t.Unlock()
+
+	if ok {
+		select {
+		case ch <- message:
+		default:
+		}
+
+		return nil
+	}
+
+	return message
+}
@@ -0,0 +1,104 @@
+package timesync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	codec "github.com/uhppoted/uhppote-core/encoding/UTO311-L0x"
+	"github.com/uhppoted/uhppote-core/messages"
+	"github.com/uhppoted/uhppote-core/types"
+
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+type controller struct {
+	t    *timesync
+	now  time.Time
+	sets []time.Time
+}
+
+func (c *controller) Close() {
+}
+
+func (c *controller) Run(*router.Switch) error {
+	return nil
+}
+
+func (c *controller) Send(id uint32, message []byte) {
+	var reply any
+
+	switch message[1] {
+	case 0x32:
+		reply = messages.GetTimeResponse{SerialNumber: 405419896, DateTime: types.DateTime(c.now)}
+
+	case 0x30:
+		rq := messages.SetTimeRequest{}
+		codec.Unmarshal(message, &rq)
+		c.sets = append(c.sets, time.Time(rq.DateTime))
+		reply = messages.SetTimeResponse{SerialNumber: 405419896, DateTime: rq.DateTime}
+	}
+
+	if bytes, err := codec.Marshal(reply); err == nil {
+		c.t.received(id, bytes)
+	}
+}
+
+func setup(now time.Time) (*timesync, *controller) {
+	c := controller{
+		now: now,
+	}
+
+	controllers := map[uint32]conn.Controller{
+		405419896: {},
+	}
+
+	t := NewTimeSync(&c, time.Minute, controllers, time.Second, context.Background())
+	c.t = t
+
+	return t, &c
+}
+
+func TestSynchroniseDriftedController(t *testing.T) {
+	location, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("timezone database not available (%v)", err)
+	}
+
+	ts, c := setup(time.Now().In(location).Add(-90 * time.Second))
+
+	if err := ts.synchronise(405419896, location); err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	if len(c.sets) != 1 {
+		t.Fatalf("incorrect number of set-time requests - expected:%v, got:%v", 1, len(c.sets))
+	}
+
+	expected := time.Now().In(location)
+	set := c.sets[0]
+	if delta := time.Date(set.Year(), set.Month(), set.Day(), set.Hour(), set.Minute(), set.Second(), 0, location).Sub(expected); delta.Abs() > 2*time.Second {
+		t.Errorf("incorrect controller time - expected:%v, got:%v", expected.Format(time.DateTime), set.Format(time.DateTime))
+	}
+}
+
+func TestSynchroniseControllerInSync(t *testing.T) {
+	ts, c := setup(time.Now())
+
+	if err := ts.synchronise(405419896, time.Local); err != nil {
+		t.Fatalf("unexpected error (%v)", err)
+	}
+
+	if len(c.sets) != 0 {
+		t.Errorf("unexpected set-time request for controller in sync")
+	}
+}
+
+func TestReceivedPassesThroughClientReplies(t *testing.T) {
+	ts, _ := setup(time.Now())
+
+	if reply := ts.received(1, []byte{0x17, 0x32}); reply == nil {
+		t.Errorf("client reply discarded")
+	}
+}
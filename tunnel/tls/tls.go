@@ -1,3 +1,19 @@
 package tls
 
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
 var ID uint32 = 0
+
+func peerCertificate(socket net.Conn) *x509.Certificate {
+	if c, ok := socket.(*tls.Conn); ok {
+		if certificates := c.ConnectionState().PeerCertificates; len(certificates) > 0 {
+			return certificates[0]
+		}
+	}
+
+	return nil
+}
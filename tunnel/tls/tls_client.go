@@ -13,6 +13,7 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/pki"
 )
 
 type tlsClient struct {
@@ -27,8 +28,8 @@ type tlsClient struct {
 	closed  chan struct{}
 }
 
-func NewTLSInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, ctx context.Context) (*tlsClient, error) {
-	client, err := makeTLSClient(hwif, spec, ca, keypair, retry, ctx)
+func NewTLSInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, options *pki.Options, revocation *pki.Revocation, retry conn.Backoff, ctx context.Context) (*tlsClient, error) {
+	client, err := makeTLSClient(hwif, spec, ca, keypair, options, revocation, retry, ctx)
 
 	if err == nil {
 		client.Infof("connector::tls-client-in")
@@ -37,8 +38,8 @@ func NewTLSInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Ce
 	return client, err
 }
 
-func NewTLSOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, ctx context.Context) (*tlsClient, error) {
-	client, err := makeTLSClient(hwif, spec, ca, keypair, retry, ctx)
+func NewTLSOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, options *pki.Options, revocation *pki.Revocation, retry conn.Backoff, ctx context.Context) (*tlsClient, error) {
+	client, err := makeTLSClient(hwif, spec, ca, keypair, options, revocation, retry, ctx)
 
 	if err == nil {
 		client.Infof("connector::tls-client-out")
@@ -47,7 +48,7 @@ func NewTLSOutClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.C
 	return client, err
 }
 
-func makeTLSClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, ctx context.Context) (*tlsClient, error) {
+func makeTLSClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, options *pki.Options, revocation *pki.Revocation, retry conn.Backoff, ctx context.Context) (*tlsClient, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 	if err != nil {
 		return nil, err
@@ -56,21 +57,20 @@ func makeTLSClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Cer
 	}
 
 	config := tls.Config{
-		RootCAs: ca,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-		},
+		RootCAs:                  ca,
 		PreferServerCipherSuites: true,
-		MinVersion:               tls.VersionTLS12,
 	}
 
+	options.Apply(&config)
+
 	if keypair != nil {
 		config.Certificates = []tls.Certificate{*keypair}
 	}
 
+	if revocation != nil {
+		config.VerifyConnection = revocation.VerifyConnection
+	}
+
 	in := tlsClient{
 		Conn: conn.Conn{
 			Tag: "TLS",
@@ -11,13 +11,14 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/pki"
 )
 
 type tlsEventInClient struct {
 	tlsEventClient
 }
 
-func NewTLSEventInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, retry conn.Backoff, ctx context.Context) (*tlsEventInClient, error) {
+func NewTLSEventInClient(hwif string, spec string, ca *x509.CertPool, keypair *tls.Certificate, options *pki.Options, revocation *pki.Revocation, retry conn.Backoff, ctx context.Context) (*tlsEventInClient, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 	if err != nil {
 		return nil, err
@@ -26,21 +27,20 @@ func NewTLSEventInClient(hwif string, spec string, ca *x509.CertPool, keypair *t
 	}
 
 	config := tls.Config{
-		RootCAs: ca,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-		},
+		RootCAs:                  ca,
 		PreferServerCipherSuites: true,
-		MinVersion:               tls.VersionTLS12,
 	}
 
+	options.Apply(&config)
+
 	if keypair != nil {
 		config.Certificates = []tls.Certificate{*keypair}
 	}
 
+	if revocation != nil {
+		config.VerifyConnection = revocation.VerifyConnection
+	}
+
 	tcp := tlsEventInClient{
 		tlsEventClient{
 			Conn: conn.Conn{
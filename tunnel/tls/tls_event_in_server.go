@@ -10,13 +10,14 @@ import (
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/pki"
 )
 
 type tlsEventInServer struct {
 	tlsEventServer
 }
 
-func NewTLSEventInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, ctx context.Context) (*tlsEventInServer, error) {
+func NewTLSEventInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, options *pki.Options, revocation *pki.Revocation, retry conn.Backoff, ctx context.Context) (*tlsEventInServer, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 
 	if err != nil {
@@ -30,20 +31,21 @@ func NewTLSEventInServer(hwif string, spec string, ca *x509.CertPool, keypair tl
 	config := tls.Config{
 		ClientCAs:    ca,
 		Certificates: []tls.Certificate{keypair},
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-		},
-		ClientAuth: tls.VerifyClientCertIfGiven,
-		MinVersion: tls.VersionTLS12,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
 	}
 
+	options.Apply(&config)
+
 	if requireClientCertificate {
 		config.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 
+	if revocation != nil {
+		config.Certificates = nil
+		config.GetCertificate = revocation.GetCertificate(keypair)
+		config.VerifyConnection = revocation.VerifyConnection
+	}
+
 	tcp := tlsEventInServer{
 		tlsEventServer{
 			Conn: conn.Conn{
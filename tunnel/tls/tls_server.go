@@ -15,7 +15,9 @@ import (
 
 	"github.com/uhppoted/uhppoted-tunnel/protocol"
 	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/acl"
 	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/pki"
 )
 
 type tlsServer struct {
@@ -23,6 +25,7 @@ type tlsServer struct {
 	hwif        string
 	addr        *net.TCPAddr
 	config      *tls.Config
+	acl         *acl.ACL
 	retry       conn.Backoff
 	connections map[net.Conn]struct{}
 	pending     map[uint32]context.CancelFunc
@@ -32,8 +35,8 @@ type tlsServer struct {
 	sync.RWMutex
 }
 
-func NewTLSInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, ctx context.Context) (*tlsServer, error) {
-	server, err := makeTLSServer(hwif, spec, ca, keypair, requireClientCertificate, retry, ctx)
+func NewTLSInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, options *pki.Options, revocation *pki.Revocation, permissions *acl.ACL, retry conn.Backoff, ctx context.Context) (*tlsServer, error) {
+	server, err := makeTLSServer(hwif, spec, ca, keypair, requireClientCertificate, options, revocation, permissions, retry, ctx)
 
 	if err == nil {
 		server.Infof("connector::tls-server-in")
@@ -42,8 +45,8 @@ func NewTLSInServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Cer
 	return server, err
 }
 
-func NewTLSOutServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, ctx context.Context) (*tlsServer, error) {
-	server, err := makeTLSServer(hwif, spec, ca, keypair, requireClientCertificate, retry, ctx)
+func NewTLSOutServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, options *pki.Options, revocation *pki.Revocation, retry conn.Backoff, ctx context.Context) (*tlsServer, error) {
+	server, err := makeTLSServer(hwif, spec, ca, keypair, requireClientCertificate, options, revocation, nil, retry, ctx)
 
 	if err == nil {
 		server.Infof("connector::tls-server-out")
@@ -52,7 +55,7 @@ func NewTLSOutServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Ce
 	return server, err
 }
 
-func makeTLSServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, retry conn.Backoff, ctx context.Context) (*tlsServer, error) {
+func makeTLSServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Certificate, requireClientCertificate bool, options *pki.Options, revocation *pki.Revocation, permissions *acl.ACL, retry conn.Backoff, ctx context.Context) (*tlsServer, error) {
 	addr, err := net.ResolveTCPAddr("tcp", spec)
 
 	if err != nil {
@@ -66,20 +69,21 @@ func makeTLSServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Cert
 	config := tls.Config{
 		ClientCAs:    ca,
 		Certificates: []tls.Certificate{keypair},
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-		},
-		ClientAuth: tls.VerifyClientCertIfGiven,
-		MinVersion: tls.VersionTLS12,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
 	}
 
+	options.Apply(&config)
+
 	if requireClientCertificate {
 		config.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 
+	if revocation != nil {
+		config.Certificates = nil
+		config.GetCertificate = revocation.GetCertificate(keypair)
+		config.VerifyConnection = revocation.VerifyConnection
+	}
+
 	tcp := tlsServer{
 		Conn: conn.Conn{
 			Tag: "TLS",
@@ -87,6 +91,7 @@ func makeTLSServer(hwif string, spec string, ca *x509.CertPool, keypair tls.Cert
 		hwif:        hwif,
 		addr:        addr,
 		config:      &config,
+		acl:         permissions,
 		retry:       retry,
 		connections: map[net.Conn]struct{}{},
 		pending:     map[uint32]context.CancelFunc{},
@@ -258,6 +263,13 @@ func (tcp *tlsServer) received(buffer []byte, router *router.Switch, socket net.
 		id, msg, remaining := protocol.Depacketize(buffer)
 		buffer = remaining
 
+		if msg != nil {
+			if err := tcp.acl.Allow(peerCertificate(socket), msg); err != nil {
+				tcp.Warnf("msg %v  %v", id, err)
+				continue
+			}
+		}
+
 		router.Received(id, msg, func(message []byte) {
 			tcp.send(socket, id, message)
 		})
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -15,15 +16,20 @@ import (
 
 type udpBroadcast struct {
 	conn.Conn
-	hwif    string
-	addr    *net.UDPAddr
-	timeout time.Duration
-	ctx     context.Context
-	ch      chan protocol.Message
-	closed  chan struct{}
+	hwif        string
+	addr        *net.UDPAddr
+	timeout     time.Duration
+	retries     int
+	controllers map[uint32]conn.Controller
+	ctx         context.Context
+	ch          chan protocol.Message
+	closed      chan struct{}
 }
 
-func NewUDPBroadcast(hwif string, spec string, timeout time.Duration, ctx context.Context) (*udpBroadcast, error) {
+// NewUDPBroadcast creates a UDP broadcast OUT connector. Idempotent requests that have not received a
+// reply are rebroadcast up to 'retries' times within the request timeout, which can be overridden for
+// individual controllers in the controllers table.
+func NewUDPBroadcast(hwif string, spec string, controllers map[uint32]conn.Controller, timeout time.Duration, retries int, ctx context.Context) (*udpBroadcast, error) {
 	addr, err := net.ResolveUDPAddr("udp", spec)
 	if err != nil {
 		return nil, err
@@ -41,12 +47,14 @@ func NewUDPBroadcast(hwif string, spec string, timeout time.Duration, ctx contex
 		Conn: conn.Conn{
 			Tag: "UDP",
 		},
-		hwif:    hwif,
-		addr:    addr,
-		timeout: timeout,
-		ctx:     ctx,
-		ch:      make(chan protocol.Message),
-		closed:  make(chan struct{}),
+		hwif:        hwif,
+		addr:        addr,
+		timeout:     timeout,
+		retries:     retries,
+		controllers: controllers,
+		ctx:         ctx,
+		ch:          make(chan protocol.Message),
+		closed:      make(chan struct{}),
 	}
 
 	udp.Infof("connector::udp-broadcast")
@@ -91,7 +99,7 @@ func (udp *udpBroadcast) Send(id uint32, msg []byte) {
 }
 
 func (udp *udpBroadcast) send(id uint32, message []byte) {
-	udp.Dumpf(message, "broadcast (%v bytes)", len(message))
+	udp.DumpRequestf(message, "broadcast (%v bytes)", len(message))
 
 	listener := net.ListenConfig{
 		Control: func(network, address string, connection syscall.RawConn) error {
@@ -112,11 +120,14 @@ func (udp *udpBroadcast) send(id uint32, message []byte) {
 	} else {
 		defer socket.Close()
 
+		timeout := conn.Timeout(message, udp.controllers, udp.timeout)
+		replied := atomic.Bool{}
+
 		if err := socket.SetWriteDeadline(time.Now().Add(1000 * time.Millisecond)); err != nil {
 			udp.Warnf("%v", err)
 		}
 
-		if err := socket.SetReadDeadline(time.Now().Add(5*time.Second + udp.timeout)); err != nil {
+		if err := socket.SetReadDeadline(time.Now().Add(5*time.Second + timeout)); err != nil {
 			udp.Warnf("%v", err)
 		}
 
@@ -125,7 +136,7 @@ func (udp *udpBroadcast) send(id uint32, message []byte) {
 		} else {
 			udp.Debugf("sent %v bytes to %v\n", N, udp.addr)
 
-			ctx, cancel := context.WithTimeout(udp.ctx, udp.timeout+5*time.Second)
+			ctx, cancel := context.WithTimeout(udp.ctx, timeout+5*time.Second)
 
 			defer cancel()
 
@@ -139,7 +150,9 @@ func (udp *udpBroadcast) send(id uint32, message []byte) {
 					} else if err != nil {
 						return
 					} else {
-						udp.Dumpf(reply[0:N], "received %v bytes from %v", N, remote)
+						udp.DumpReplyf(reply[0:N], "received %v bytes from %v", N, remote)
+
+						replied.Store(true)
 
 						udp.ch <- protocol.Message{
 							ID:      id,
@@ -149,12 +162,26 @@ func (udp *udpBroadcast) send(id uint32, message []byte) {
 				}
 			}()
 
-			select {
-			case <-time.After(udp.timeout):
-				// Ok
+			attempts := conn.Attempts(message, udp.retries, timeout)
+			for i, wait := range attempts {
+				select {
+				case <-time.After(wait):
+					// Ok
+
+				case <-ctx.Done():
+					udp.Warnf("%v", ctx.Err())
+					return
+				}
+
+				if i+1 < len(attempts) && !replied.Load() {
+					udp.Debugf("request %v  no reply - retrying (%v of %v)", id, i+1, len(attempts)-1)
 
-			case <-ctx.Done():
-				udp.Warnf("%v", ctx.Err())
+					if err := socket.SetWriteDeadline(time.Now().Add(1000 * time.Millisecond)); err != nil {
+						udp.Warnf("%v", err)
+					} else if _, err := socket.WriteTo(message, udp.addr); err != nil {
+						udp.Warnf("%v", err)
+					}
+				}
 			}
 		}
 	}
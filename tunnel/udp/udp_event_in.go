@@ -129,7 +129,7 @@ func (udp *udpEventIn) listen(socket net.PacketConn, router *router.Switch) {
 		}
 
 		id := protocol.NextID()
-		udp.Dumpf(buffer[:N], "event %v  %v bytes from %v", id, N, remote)
+		udp.DumpEventf(buffer[:N], "event %v  %v bytes from %v", id, N, remote)
 
 		router.Received(id, buffer[:N], nil)
 	}
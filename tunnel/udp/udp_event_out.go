@@ -90,7 +90,7 @@ func (udp *udpEventOut) Send(id uint32, msg []byte) {
 }
 
 func (udp *udpEventOut) send(id uint32, message []byte) {
-	udp.Dumpf(message, "event/out (%v bytes)", len(message))
+	udp.DumpEventf(message, "event/out (%v bytes)", len(message))
 
 	dialer := &net.Dialer{
 		Timeout: udp.timeout,
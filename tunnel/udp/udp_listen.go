@@ -143,10 +143,10 @@ func (udp *udpListen) listen(socket net.PacketConn, router *router.Switch) {
 		}
 
 		id := protocol.NextID()
-		udp.Dumpf(buffer[:N], "request %v  %v bytes from %v", id, N, remote)
+		udp.DumpRequestf(buffer[:N], "request %v  %v bytes from %v", id, N, remote)
 
 		h := func(reply []byte) {
-			udp.Dumpf(reply, "reply %v  %v bytes for %v", id, len(reply), remote)
+			udp.DumpReplyf(reply, "reply %v  %v bytes for %v", id, len(reply), remote)
 
 			if N, err := socket.WriteTo(reply, remote); err != nil {
 				udp.Warnf("%v", err)
@@ -0,0 +1,122 @@
+package validate
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/uhppoted/uhppoted-tunnel/protocol"
+	"github.com/uhppoted/uhppoted-tunnel/router"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel"
+	"github.com/uhppoted/uhppoted-tunnel/tunnel/conn"
+)
+
+// Mode is the validation mode for the messages received by an IN connector.
+type Mode int
+
+const (
+	None Mode = iota
+	Strict
+	Passthrough
+)
+
+func (m Mode) String() string {
+	return [...]string{"none", "strict", "passthrough"}[m]
+}
+
+// ParseMode parses a validation mode (none, strict or passthrough).
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none":
+		return None, nil
+	case "strict":
+		return Strict, nil
+	case "passthrough":
+		return Passthrough, nil
+	default:
+		return None, fmt.Errorf("invalid validation mode '%v' (expected none, strict or passthrough)", s)
+	}
+}
+
+// validator wraps an IN connector and validates the received messages before they are forwarded across
+// the tunnel. In strict mode invalid messages are discarded and in passthrough mode (e.g. for future
+// protocol versions) invalid messages are logged and counted but forwarded.
+type validator struct {
+	conn.Conn
+	in       tunnel.Conn
+	mode     Mode
+	events   bool
+	rejected map[string]uint64
+	total    uint64
+	sync.Mutex
+}
+
+// NewValidator wraps an IN connector with message validation. The events flag selects validation of
+// controller events rather than requests.
+func NewValidator(in tunnel.Conn, mode Mode, events bool) *validator {
+	v := validator{
+		Conn: conn.Conn{
+			Tag: "VALIDATE",
+		},
+		in:       in,
+		mode:     mode,
+		events:   events,
+		rejected: map[string]uint64{},
+	}
+
+	v.Infof("%v message validation", mode)
+
+	return &v
+}
+
+func (v *validator) Close() {
+	v.in.Close()
+
+	v.Lock()
+	defer v.Unlock()
+
+	if v.total > 0 {
+		list := []string{}
+		for _, reason := range slices.Sorted(maps.Keys(v.rejected)) {
+			list = append(list, fmt.Sprintf("%v: %v", reason, v.rejected[reason]))
+		}
+
+		v.Infof("%v invalid messages (%v)", v.total, strings.Join(list, ", "))
+	}
+}
+
+func (v *validator) Run(router *router.Switch) error {
+	filtered := router.Filter(v.validate)
+
+	return v.in.Run(&filtered)
+}
+
+func (v *validator) Send(id uint32, message []byte) {
+	v.in.Send(id, message)
+}
+
+func (v *validator) validate(id uint32, message []byte) []byte {
+	err := protocol.Validate(message, v.events)
+	if err == nil {
+		return message
+	}
+
+	v.Lock()
+	reason, _, _ := strings.Cut(err.Error(), " (")
+	v.rejected[reason]++
+	v.total++
+	total := v.total
+	v.Unlock()
+
+	if v.mode == Passthrough {
+		v.Warnf("message %v  %v  (forwarded, %v invalid messages)", id, err, total)
+
+		return message
+	}
+
+	v.Warnf("message %v  %v  (discarded, %v invalid messages)", id, err, total)
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package validate
+
+import (
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := map[string]Mode{
+		"":            None,
+		"none":        None,
+		"strict":      Strict,
+		"Passthrough": Passthrough,
+	}
+
+	for s, expected := range tests {
+		if mode, err := ParseMode(s); err != nil || mode != expected {
+			t.Errorf("incorrect mode for '%v' - expected:%v, got:%v (%v)", s, expected, mode, err)
+		}
+	}
+
+	if _, err := ParseMode("lax"); err == nil {
+		t.Errorf("expected error for invalid mode")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := make([]byte, 64)
+	valid[0] = 0x17
+	valid[1] = 0x94
+
+	invalid := []byte("GET / HTTP/1.1\\r\\n")
+
+	tests := []struct {
+		mode     Mode
+		message  []byte
+		expected bool
+	}{
+		{Strict, valid, true},
+		{Strict, invalid, false},
+		{Passthrough, valid, true},
+		{Passthrough, invalid, true},
+	}
+
+	for _, test := range tests {
+		v := NewValidator(nil, test.mode, false)
+
+		if forwarded := v.validate(1, test.message) != nil; forwarded != test.expected {
+			t.Errorf("%v: incorrect validation for %q - expected:%v, got:%v", test.mode, test.message, test.expected, forwarded)
+		}
+	}
+
+	v := NewValidator(nil, Strict, false)
+	v.validate(1, invalid)
+	v.validate(2, invalid[:1])
+	v.validate(3, valid)
+
+	if v.total != 2 || v.rejected["invalid message length"] != 2 {
+		t.Errorf("incorrect rejected message count - expected:%v, got:%v %v", 2, v.total, v.rejected)
+	}
+}